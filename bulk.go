@@ -0,0 +1,267 @@
+package imperva
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultBulkConcurrency is the number of concurrent requests of bulk
+// operations when BulkOptions.Concurrency is not set.
+const DefaultBulkConcurrency = 4
+
+// rollbackTimeout bounds a rollback, which runs even when the context of
+// the bulk operation is cancelled.
+const rollbackTimeout = 5 * time.Minute
+
+// BulkOptions controls CreateRuleOnSites, UpdateRules and DeleteRules.
+// Requests go through the client's rate limiter, so Concurrency bounds the
+// number of requests in flight, not their rate.
+type BulkOptions struct {
+	// Concurrency is the size of the worker pool, DefaultBulkConcurrency when zero.
+	Concurrency int
+	// Rollback undoes the items already applied when any item fails: created
+	// rules are deleted, updated rules restored and deleted rules recreated.
+	// Items not started yet when the failure happens are skipped. The
+	// rollback still runs when the failure is the cancellation of the
+	// context. A *JournalError is not a failure: the item stays applied.
+	Rollback bool
+}
+
+func (o BulkOptions) workers() int {
+	if o.Concurrency <= 0 {
+		return DefaultBulkConcurrency
+	}
+	return o.Concurrency
+}
+
+// BulkResult is the outcome of one item of a bulk operation.
+type BulkResult struct {
+	SiteID int
+	// RuleID is the ID of the created, updated or deleted rule.
+	RuleID int
+	// Rule is the rule returned by the API for creations and updates.
+	Rule    *Rule
+	Err     error
+	Skipped bool // not attempted because of an earlier failure
+
+	RolledBack  bool
+	RollbackErr error
+}
+
+// OK reports whether the item was applied and is still in effect. An item
+// whose Err is a *JournalError was applied.
+func (r BulkResult) OK() bool {
+	return (r.Err == nil || isJournalError(r.Err)) && !r.Skipped && !r.RolledBack
+}
+
+// RuleUpdate is an item of UpdateRules.
+type RuleUpdate struct {
+	SiteID int
+	RuleID int
+	Rule   Rule
+}
+
+// RuleRef identifies a rule of a site.
+type RuleRef struct {
+	SiteID int
+	RuleID int
+}
+
+// bulkItem applies one item of a bulk operation and returns how to undo it.
+type bulkItem func(ctx context.Context, res *BulkResult) (undo func(ctx context.Context) error, err error)
+
+// runBulk applies items on a pool of workers and rolls the applied ones back
+// on failure if requested. It returns the results in item order and the
+// first error encountered.
+func runBulk(ctx context.Context, opts BulkOptions, results []BulkResult, items []bulkItem) ([]BulkResult, error) {
+	undos := make([]func(context.Context) error, len(items))
+	var failed atomic.Bool
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(opts.workers(), len(items)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				res := &results[i]
+				if opts.Rollback && failed.Load() {
+					res.Skipped = true
+					continue
+				}
+				if err := ctx.Err(); err != nil {
+					res.Err = err
+					failed.Store(true)
+					continue
+				}
+				undos[i], res.Err = items[i](ctx, res)
+				if res.Err != nil && !isJournalError(res.Err) {
+					failed.Store(true)
+				}
+			}
+		}()
+	}
+	for i := range items {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	if opts.Rollback && failed.Load() {
+		rollback(ctx, opts, results, undos)
+	}
+
+	for _, res := range results {
+		if res.Err != nil {
+			return results, res.Err
+		}
+	}
+	return results, nil
+}
+
+// rollback runs the undo functions of the applied items. It detaches from
+// the cancellation of ctx, which may be the failure being rolled back.
+func rollback(ctx context.Context, opts BulkOptions, results []BulkResult, undos []func(context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+	defer cancel()
+	sem := make(chan struct{}, opts.workers())
+	var wg sync.WaitGroup
+	for i, undo := range undos {
+		if undo == nil || !results[i].OK() {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			if err := undo(ctx); err != nil {
+				results[i].RollbackErr = err
+				if !isJournalError(err) {
+					return
+				}
+			}
+			results[i].RolledBack = true
+		}()
+	}
+	wg.Wait()
+}
+
+// CreateRuleOnSites creates rule on every site of siteIDs.
+func (c *Client) CreateRuleOnSites(siteIDs []int, rule Rule, opts BulkOptions) ([]BulkResult, error) {
+	return c.CreateRuleOnSitesContext(context.Background(), siteIDs, rule, opts)
+}
+
+// CreateRuleOnSitesContext is like CreateRuleOnSites but carries ctx for cancellation and deadlines.
+func (c *Client) CreateRuleOnSitesContext(ctx context.Context, siteIDs []int, rule Rule, opts BulkOptions) ([]BulkResult, error) {
+	rule.ID = 0
+	results := make([]BulkResult, len(siteIDs))
+	items := make([]bulkItem, len(siteIDs))
+	for i, siteID := range siteIDs {
+		results[i].SiteID = siteID
+		items[i] = func(ctx context.Context, res *BulkResult) (func(context.Context) error, error) {
+			created, err := c.CreateRuleContext(ctx, siteID, rule)
+			if err != nil {
+				err = fmt.Errorf("create rule %q on site %d: %w", rule.Name, siteID, err)
+			}
+			if created == nil {
+				return nil, err
+			}
+			res.Rule, res.RuleID = created, created.ID
+			return func(ctx context.Context) error {
+				return c.DeleteRuleContext(ctx, siteID, created.ID)
+			}, err
+		}
+	}
+	return runBulk(ctx, opts, results, items)
+}
+
+// UpdateRules applies updates. With Rollback, each rule is read before
+// being updated so it can be restored as it was.
+func (c *Client) UpdateRules(updates []RuleUpdate, opts BulkOptions) ([]BulkResult, error) {
+	return c.UpdateRulesContext(context.Background(), updates, opts)
+}
+
+// UpdateRulesContext is like UpdateRules but carries ctx for cancellation and deadlines.
+func (c *Client) UpdateRulesContext(ctx context.Context, updates []RuleUpdate, opts BulkOptions) ([]BulkResult, error) {
+	results := make([]BulkResult, len(updates))
+	items := make([]bulkItem, len(updates))
+	for i, u := range updates {
+		results[i].SiteID, results[i].RuleID = u.SiteID, u.RuleID
+		items[i] = func(ctx context.Context, res *BulkResult) (func(context.Context) error, error) {
+			var previous *Rule
+			if opts.Rollback {
+				var err error
+				if previous, err = c.GetRuleContext(ctx, u.SiteID, u.RuleID); err != nil {
+					return nil, fmt.Errorf("read rule %d of site %d: %w", u.RuleID, u.SiteID, err)
+				}
+			}
+			want := u.Rule
+			want.ID = u.RuleID
+			updated, err := c.UpdateRuleContext(ctx, u.SiteID, u.RuleID, want)
+			if err != nil {
+				err = fmt.Errorf("update rule %d of site %d: %w", u.RuleID, u.SiteID, err)
+			}
+			if updated == nil {
+				return nil, err
+			}
+			res.Rule = updated
+			if previous == nil {
+				return nil, err
+			}
+			// Overwrite on rollback so the fields added by the update are cleared.
+			return func(ctx context.Context) error {
+				_, err := c.OverwriteRuleContext(ctx, u.SiteID, u.RuleID, *previous)
+				return err
+			}, err
+		}
+	}
+	return runBulk(ctx, opts, results, items)
+}
+
+// DeleteRules deletes the rules of refs. With Rollback, each rule is read
+// before being deleted so it can be recreated; a recreated rule gets a new
+// ID, reported in BulkResult.Rule.
+func (c *Client) DeleteRules(refs []RuleRef, opts BulkOptions) ([]BulkResult, error) {
+	return c.DeleteRulesContext(context.Background(), refs, opts)
+}
+
+// DeleteRulesContext is like DeleteRules but carries ctx for cancellation and deadlines.
+func (c *Client) DeleteRulesContext(ctx context.Context, refs []RuleRef, opts BulkOptions) ([]BulkResult, error) {
+	results := make([]BulkResult, len(refs))
+	items := make([]bulkItem, len(refs))
+	for i, ref := range refs {
+		results[i].SiteID, results[i].RuleID = ref.SiteID, ref.RuleID
+		items[i] = func(ctx context.Context, res *BulkResult) (func(context.Context) error, error) {
+			var previous *Rule
+			if opts.Rollback {
+				var err error
+				if previous, err = c.GetRuleContext(ctx, ref.SiteID, ref.RuleID); err != nil {
+					return nil, fmt.Errorf("read rule %d of site %d: %w", ref.RuleID, ref.SiteID, err)
+				}
+			}
+			err := c.DeleteRuleContext(ctx, ref.SiteID, ref.RuleID)
+			if err != nil {
+				err = fmt.Errorf("delete rule %d of site %d: %w", ref.RuleID, ref.SiteID, err)
+				if !isJournalError(err) {
+					return nil, err
+				}
+			}
+			if previous == nil {
+				return nil, err
+			}
+			return func(ctx context.Context) error {
+				want := *previous
+				want.ID = 0
+				recreated, err := c.CreateRuleContext(ctx, ref.SiteID, want)
+				if recreated != nil {
+					res.Rule = recreated
+				}
+				return err
+			}, err
+		}
+	}
+	return runBulk(ctx, opts, results, items)
+}
@@ -0,0 +1,80 @@
+package imperva_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"imperva-waf-client"
+	"imperva-waf-client/impervatest"
+)
+
+func TestCreateRuleOnSitesRollsBackOnCancel(t *testing.T) {
+	srv := impervatest.NewServer()
+	defer srv.Close()
+	for id := 1; id <= 3; id++ {
+		srv.AddSite(imperva.Site{SiteID: id})
+	}
+	client := srv.Client()
+
+	// Cancel the operation when the second rule is being created.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	creates := 0
+	client.Use(func(next imperva.Doer) imperva.Doer {
+		return imperva.DoerFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Method == http.MethodPost && strings.HasSuffix(req.URL.Path, "/rules") {
+				if creates++; creates == 2 {
+					cancel()
+					return nil, context.Canceled
+				}
+			}
+			return next.Do(req)
+		})
+	})
+
+	rule := imperva.Rule{Name: "block admin", Action: imperva.RuleActionBlock, Filter: `URL == "/admin"`}
+	results, err := client.CreateRuleOnSitesContext(ctx, []int{1, 2, 3}, rule, imperva.BulkOptions{Concurrency: 1, Rollback: true})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if !results[0].RolledBack || results[0].RollbackErr != nil {
+		t.Errorf("first result = %+v, want rolled back", results[0])
+	}
+	for id := 1; id <= 3; id++ {
+		if rules := srv.Rules(id); len(rules) != 0 {
+			t.Errorf("site %d rules = %+v, want none", id, rules)
+		}
+	}
+}
+
+func TestUpdateRulesRollbackRestoresFields(t *testing.T) {
+	srv := impervatest.NewServer()
+	defer srv.Close()
+	srv.AddSite(imperva.Site{SiteID: 1})
+	rule := srv.AddRule(1, imperva.Rule{Name: "block", Action: imperva.RuleActionBlock, Filter: `URL == "/admin"`})
+	client := srv.Client()
+
+	update := rule
+	update.ResponseCode = 403
+	updates := []imperva.RuleUpdate{
+		{SiteID: 1, RuleID: rule.ID, Rule: update},
+		{SiteID: 1, RuleID: rule.ID + 1, Rule: update}, // does not exist
+	}
+	results, err := client.UpdateRules(updates, imperva.BulkOptions{Concurrency: 1, Rollback: true})
+	if !errors.Is(err, imperva.ErrNotFound) {
+		t.Fatalf("err = %v, want ErrNotFound", err)
+	}
+	if !results[0].RolledBack {
+		t.Fatalf("first result = %+v, want rolled back", results[0])
+	}
+	got, err := client.GetRule(1, rule.ID)
+	if err != nil {
+		t.Fatalf("GetRule: %v", err)
+	}
+	if got.ResponseCode != 0 {
+		t.Errorf("response code after rollback = %d, want the update undone", got.ResponseCode)
+	}
+}
@@ -2,11 +2,12 @@ package imperva
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -18,6 +19,24 @@ type Client struct {
 	APIKey     string
 	AccountID  string
 	HTTPClient *http.Client
+	// Retry controls retries of transient failures. A nil policy disables retries.
+	Retry *RetryPolicy
+	// Limiter throttles outgoing requests. A nil limiter disables throttling.
+	Limiter *RateLimiter
+	// Middlewares wrap every HTTP attempt, the first one being the outermost.
+	Middlewares []Middleware
+	// ValidateFilters makes CreateRule and UpdateRule check rule filters
+	// locally before sending them.
+	ValidateFilters bool
+	// ValidateRules makes CreateRule and UpdateRule check that rules carry
+	// the fields required by their action before sending them.
+	ValidateRules bool
+	// Journal records the rule changes made through the client. A nil
+	// journal disables recording. A change that succeeded but could not be
+	// recorded returns its result along with a *JournalError.
+	Journal JournalSink
+	// Actor is the caller identity recorded in the journal, the API ID when empty.
+	Actor string
 }
 
 // Config holds the configuration for the client.
@@ -26,6 +45,12 @@ type Config struct {
 	APIID     string `json:"api_id"`
 	APIKey    string `json:"api_key"`
 	AccountID string `json:"account_id"`
+
+	// RequestsPerSecond enables client-side rate limiting when positive.
+	// The limiter is shared by every client created with the same APIID
+	// and settings; see SharedRateLimiter.
+	RequestsPerSecond float64 `json:"requests_per_second,omitempty"`
+	Burst             int     `json:"burst,omitempty"`
 }
 
 // NewClient creates a new Imperva API client.
@@ -37,6 +62,11 @@ func NewClient(config *Config) *Client {
 	// Remove trailing slash if present
 	baseURL = strings.TrimRight(baseURL, "/")
 
+	var limiter *RateLimiter
+	if config.RequestsPerSecond > 0 {
+		limiter = SharedRateLimiter(config.APIID, config.RequestsPerSecond, config.Burst)
+	}
+
 	return &Client{
 		BaseURL:   baseURL,
 		APIID:     config.APIID,
@@ -45,6 +75,8 @@ func NewClient(config *Config) *Client {
 		HTTPClient: &http.Client{
 			Timeout: time.Minute,
 		},
+		Retry:   DefaultRetryPolicy(),
+		Limiter: limiter,
 	}
 }
 
@@ -56,70 +88,237 @@ type APIResponse struct {
 }
 
 // Do performs an HTTP request and delegates to the HTTP client.
-// It adds the necessary authentication headers.
+// It adds the necessary authentication headers and waits on the client's
+// rate limiter, if any, honoring the request context.
 func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	if err := c.Limiter.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+
 	req.Header.Set("x-API-Id", c.APIID)
 	req.Header.Set("x-API-Key", c.APIKey)
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Accept", "application/json")
 
-	return c.HTTPClient.Do(req)
+	return chain(c.HTTPClient, c.Middlewares).Do(req)
+}
+
+// Use appends middlewares to the client's chain.
+func (c *Client) Use(middlewares ...Middleware) {
+	c.Middlewares = append(c.Middlewares, middlewares...)
 }
 
 // Post performs a POST request.
 func (c *Client) Post(path string, body interface{}) ([]byte, error) {
-	return c.request(http.MethodPost, path, body)
+	return c.PostContext(context.Background(), path, body)
+}
+
+// PostContext performs a POST request bound to ctx.
+func (c *Client) PostContext(ctx context.Context, path string, body interface{}) ([]byte, error) {
+	return c.request(ctx, http.MethodPost, path, body)
 }
 
 // Get performs a Get request.
 func (c *Client) Get(path string) ([]byte, error) {
-	return c.request(http.MethodGet, path, nil)
+	return c.GetContext(context.Background(), path)
+}
+
+// GetContext performs a Get request bound to ctx.
+func (c *Client) GetContext(ctx context.Context, path string) ([]byte, error) {
+	return c.request(ctx, http.MethodGet, path, nil)
 }
 
 // Put performs a Put request.
 func (c *Client) Put(path string, body interface{}) ([]byte, error) {
-	return c.request(http.MethodPut, path, body)
+	return c.PutContext(context.Background(), path, body)
+}
+
+// PutContext performs a Put request bound to ctx.
+func (c *Client) PutContext(ctx context.Context, path string, body interface{}) ([]byte, error) {
+	return c.request(ctx, http.MethodPut, path, body)
 }
 
 // Delete performs a Delete request.
 func (c *Client) Delete(path string, body interface{}) ([]byte, error) {
-	return c.request(http.MethodDelete, path, body)
+	return c.DeleteContext(context.Background(), path, body)
+}
+
+// DeleteContext performs a Delete request bound to ctx.
+func (c *Client) DeleteContext(ctx context.Context, path string, body interface{}) ([]byte, error) {
+	return c.request(ctx, http.MethodDelete, path, body)
 }
 
-func (c *Client) request(method, path string, body interface{}) ([]byte, error) {
+func (c *Client) request(ctx context.Context, method, path string, body interface{}) ([]byte, error) {
 	u, err := url.Parse(c.BaseURL + path)
 	if err != nil {
 		return nil, err
 	}
 
-	var buf io.ReadWriter
+	// Encode the body once so it can be replayed on every attempt.
+	var payload []byte
 	if body != nil {
-		buf = new(bytes.Buffer)
+		buf := new(bytes.Buffer)
 		err := json.NewEncoder(buf).Encode(body)
 		if err != nil {
 			return nil, err
 		}
+		payload = buf.Bytes()
 	}
 
-	req, err := http.NewRequest(method, u.String(), buf)
-	if err != nil {
-		return nil, err
+	attempts := 1
+	if c.Retry.allows(ctx, method) {
+		attempts = c.Retry.attempts()
 	}
 
-	resp, err := c.Do(req)
-	if err != nil {
-		return nil, err
+	for attempt := 1; ; attempt++ {
+		var reqBody io.Reader
+		if payload != nil {
+			reqBody = bytes.NewReader(payload)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, u.String(), reqBody)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := c.Do(req)
+		if err != nil {
+			if attempt < attempts && ctx.Err() == nil {
+				if err := sleepContext(ctx, c.Retry.backoff(attempt, nil)); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			return nil, err
+		}
+
+		respBody, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		if attempt < attempts && c.Retry.retryableStatus(resp.StatusCode) {
+			if err := sleepContext(ctx, c.Retry.backoff(attempt, resp)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if resp.StatusCode >= 400 {
+			return respBody, newHTTPError(method, path, resp.StatusCode, respBody)
+		}
+
+		if err := checkEnvelope(method, path, respBody); err != nil {
+			return respBody, err
+		}
+
+		return respBody, nil
 	}
-	defer resp.Body.Close()
+}
 
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+// envelope captures the error-related fields shared by Imperva responses:
+// the v1/v2 "res" code and the v3 "errors" array.
+type envelope struct {
+	Res        json.RawMessage `json:"res"`
+	ResMessage string          `json:"res_message"`
+	DebugInfo  interface{}     `json:"debug_info"`
+	Errors     []ErrorDetail   `json:"errors"`
+}
+
+// parseEnvelope decodes the envelope of body. It returns false when body is
+// not a JSON object, e.g. an empty body or a bare array. The fields are
+// decoded one by one, so a field of an unexpected type does not hide the
+// others, and an "errors" entry that cannot be decoded still counts as an
+// error.
+func parseEnvelope(body []byte) (envelope, bool) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return envelope{}, false
 	}
 
-	if resp.StatusCode >= 400 {
-		return respBody, fmt.Errorf("API request failed with status constant: %d, body: %s", resp.StatusCode, string(respBody))
+	env := envelope{Res: fields["res"]}
+	if raw, ok := fields["res_message"]; ok {
+		json.Unmarshal(raw, &env.ResMessage)
+	}
+	if raw, ok := fields["debug_info"]; ok {
+		json.Unmarshal(raw, &env.DebugInfo)
 	}
+	if raw, ok := fields["errors"]; ok {
+		if err := json.Unmarshal(raw, &env.Errors); err != nil {
+			var entries []json.RawMessage
+			if json.Unmarshal(raw, &entries) != nil {
+				entries = make([]json.RawMessage, 1)
+			}
+			env.Errors = make([]ErrorDetail, len(entries))
+			for i, entry := range entries {
+				json.Unmarshal(entry, &env.Errors[i])
+			}
+		}
+	}
+	return env, true
+}
 
-	return respBody, nil
+// res returns the "res" code, which some endpoints send as a string.
+func (e envelope) res() int {
+	if n, ok := lenientInt(e.Res); ok {
+		return n
+	}
+	return ResOK
+}
+
+// lenientInt decodes an integer sent either as a JSON number or as a string.
+func lenientInt(raw json.RawMessage) (int, bool) {
+	if len(raw) == 0 {
+		return 0, false
+	}
+	var n int
+	if err := json.Unmarshal(raw, &n); err == nil {
+		return n, true
+	}
+	var str string
+	if err := json.Unmarshal(raw, &str); err == nil {
+		if n, err := strconv.Atoi(strings.TrimSpace(str)); err == nil {
+			return n, true
+		}
+	}
+	return 0, false
+}
+
+// message returns res_message, or the first v3 error when it is absent.
+func (e envelope) message() string {
+	if e.ResMessage != "" || len(e.Errors) == 0 {
+		return e.ResMessage
+	}
+	if e.Errors[0].Detail != "" {
+		return e.Errors[0].Detail
+	}
+	return e.Errors[0].Title
+}
+
+// checkEnvelope maps an API-level failure reported in a successful HTTP
+// response to an *APIError, so no method can return an empty result for it.
+func checkEnvelope(method, path string, body []byte) error {
+	env, ok := parseEnvelope(body)
+	if !ok {
+		return nil
+	}
+	if res := env.res(); res != ResOK {
+		return newResError(method, path, APIResponse{
+			Res:        res,
+			ResMessage: env.ResMessage,
+			DebugInfo:  env.DebugInfo,
+		})
+	}
+	if len(env.Errors) > 0 {
+		return &APIError{
+			Method:     method,
+			Path:       path,
+			StatusCode: http.StatusOK,
+			ResMessage: env.message(),
+			Errors:     env.Errors,
+			Body:       body,
+		}
+	}
+	return nil
 }
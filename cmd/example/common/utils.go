@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	"imperva-waf-client"
+	"imperva-waf-client/replay"
 )
 
 // LoadConfig loads the configuration from the given file path.
@@ -25,6 +26,29 @@ func LoadConfig(path string) (*imperva.Config, error) {
 	return &config, nil
 }
 
+// SetupReplay installs a recording or replaying transport on client.
+// record is the JSONL file to write traffic to, replayPath a JSONL file to serve
+// traffic from; both may be empty. The returned function must be called once done.
+func SetupReplay(client *imperva.Client, record, replayPath string) (func(), error) {
+	switch {
+	case replayPath != "":
+		r, err := replay.Load(replayPath)
+		if err != nil {
+			return nil, fmt.Errorf("error loading replay file: %w", err)
+		}
+		client.HTTPClient.Transport = r
+		return func() {}, nil
+	case record != "":
+		f, err := os.Create(record)
+		if err != nil {
+			return nil, fmt.Errorf("error creating record file: %w", err)
+		}
+		client.HTTPClient.Transport = replay.NewRecorder(f, client.HTTPClient.Transport)
+		return func() { f.Close() }, nil
+	}
+	return func() {}, nil
+}
+
 // SelectSite lists available sites and prompts the user to select one.
 // Returns the selected Site ID.
 func SelectSite(client *imperva.Client) (int, error) {
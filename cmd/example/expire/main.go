@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"imperva-waf-client"
+	"imperva-waf-client/cmd/example/common"
+)
+
+func main() {
+	configPath := flag.String("config", "config.json", "Path to configuration file")
+	sitesFlag := flag.String("sites", "", "Comma-separated site IDs to clean up (default: all sites of the account)")
+	dryRun := flag.Bool("dry-run", false, "Only report expired temporary rules, do not delete them")
+	flag.Parse()
+
+	config, err := common.LoadConfig(*configPath)
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		return
+	}
+
+	client := imperva.NewClient(config)
+	fmt.Println("Client initialized.")
+
+	var siteIDs []int
+	if *sitesFlag != "" {
+		for _, s := range strings.Split(*sitesFlag, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil {
+				fmt.Printf("Invalid site ID %q\n", s)
+				return
+			}
+			siteIDs = append(siteIDs, id)
+		}
+	} else {
+		sites, err := client.ListAllSites()
+		if err != nil {
+			fmt.Printf("Error listing sites: %v\n", err)
+			return
+		}
+		for _, s := range sites {
+			siteIDs = append(siteIDs, s.SiteID)
+		}
+	}
+
+	fmt.Printf("\nLooking for expired temporary rules on %d sites...\n", len(siteIDs))
+	report, err := client.ExpireRules(siteIDs, imperva.ExpireOptions{DryRun: *dryRun})
+	if err != nil {
+		fmt.Printf("Error expiring rules: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Checked %d temporary rules, %d expired:\n", report.Checked, len(report.Expired))
+	for _, e := range report.Expired {
+		status := "would be deleted"
+		switch {
+		case e.Err != nil:
+			status = fmt.Sprintf("deletion failed: %v", e.Err)
+		case e.Deleted:
+			status = "deleted"
+		}
+		fmt.Printf(" - Site %d [%d] %s (expired %s): %s\n", e.SiteID, e.Rule.ID, e.Rule.Name, e.ExpiredAt.Format("2006-01-02 15:04"), status)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"imperva-waf-client"
+	"imperva-waf-client/cmd/example/common"
+	"imperva-waf-client/lint"
+)
+
+func main() {
+	configPath := flag.String("config", "config.json", "Path to configuration file")
+	siteID := flag.Int("site", 0, "Site ID whose rules to lint")
+	jsonOutput := flag.Bool("json", false, "Print findings as JSON")
+	minSeverity := flag.String("min-severity", "info", "Lowest severity to report: info, warning or error")
+	flag.Parse()
+
+	if *siteID == 0 {
+		fmt.Println("Missing -site")
+		os.Exit(2)
+	}
+
+	var opts lint.Options
+	if err := opts.MinSeverity.UnmarshalText([]byte(*minSeverity)); err != nil {
+		fmt.Printf("Invalid -min-severity: %v\n", err)
+		os.Exit(2)
+	}
+
+	config, err := common.LoadConfig(*configPath)
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+
+	client := imperva.NewClient(config)
+	rules, err := client.ListRules(*siteID)
+	if err != nil {
+		fmt.Printf("Error listing rules: %v\n", err)
+		os.Exit(1)
+	}
+
+	findings := lint.Lint(rules, opts)
+	if *jsonOutput {
+		if err := lint.WriteJSON(os.Stdout, findings); err != nil {
+			fmt.Printf("Error writing findings: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		fmt.Printf("Linted %d rules of site %d, %d findings:\n", len(rules), *siteID, len(findings))
+		for _, f := range findings {
+			fmt.Printf(" - %s\n", f)
+		}
+	}
+
+	for _, f := range findings {
+		if f.Severity == lint.Error {
+			os.Exit(1)
+		}
+	}
+}
@@ -14,6 +14,8 @@ func main() {
 	configPath := flag.String("config", "config.json", "Path to configuration file")
 	siteIDFlag := flag.Int("site", 0, "Site ID to test")
 	dryRun := flag.String("verify", "", "Path to a JSON dump to verify parsing (e.g. visits_example.json)")
+	record := flag.String("record", "", "Record API traffic to this JSONL file")
+	replayPath := flag.String("replay", "", "Serve API traffic from this JSONL recording instead of the network")
 	flag.Parse()
 
 	if *dryRun != "" {
@@ -29,6 +31,12 @@ func main() {
 	}
 
 	client := imperva.NewClient(config)
+	done, err := common.SetupReplay(client, *record, *replayPath)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	defer done()
 	fmt.Println("Client initialized.")
 
 	siteID := *siteIDFlag
@@ -0,0 +1,538 @@
+package imperva
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+)
+
+// DeliveryCategory groups delivery rules by what they do to traffic. Each
+// category of a site holds its own ordered list of rules.
+type DeliveryCategory string
+
+// DeliveryCategory constants
+const (
+	DeliveryRedirect           DeliveryCategory = "REDIRECT"
+	DeliverySimplifiedRedirect DeliveryCategory = "SIMPLIFIED_REDIRECT"
+	DeliveryRewrite            DeliveryCategory = "REWRITE"
+	DeliveryRewriteResponse    DeliveryCategory = "REWRITE_RESPONSE"
+	DeliveryForward            DeliveryCategory = "FORWARD"
+)
+
+// deliveryCategories lists the categories in the order of DeliveryRules.
+var deliveryCategories = []DeliveryCategory{
+	DeliveryRedirect,
+	DeliverySimplifiedRedirect,
+	DeliveryRewrite,
+	DeliveryRewriteResponse,
+	DeliveryForward,
+}
+
+// deliveryActions maps the delivery rule actions to their category.
+var deliveryActions = map[string]DeliveryCategory{
+	RuleActionRedirect:                    DeliveryRedirect,
+	RuleActionSimplifiedRedirect:          DeliverySimplifiedRedirect,
+	RuleActionRewriteURL:                  DeliveryRewrite,
+	RuleActionRewriteHeader:               DeliveryRewrite,
+	RuleActionRewriteCookie:               DeliveryRewrite,
+	RuleActionDeleteHeader:                DeliveryRewrite,
+	RuleActionDeleteCookie:                DeliveryRewrite,
+	RuleActionResponseRewriteHeader:       DeliveryRewriteResponse,
+	RuleActionResponseDeleteHeader:        DeliveryRewriteResponse,
+	RuleActionResponseRewriteResponseCode: DeliveryRewriteResponse,
+	RuleActionCustomErrorResponse:         DeliveryRewriteResponse,
+	RuleActionForwardToDC:                 DeliveryForward,
+	RuleActionForwardToPort:               DeliveryForward,
+}
+
+// DeliveryCategoryOf returns the category of a delivery rule action, and
+// false for security actions such as blocks and challenges.
+func DeliveryCategoryOf(action string) (DeliveryCategory, bool) {
+	c, ok := deliveryActions[action]
+	return c, ok
+}
+
+// DeliveryRuleBase holds the fields shared by the delivery rules of every
+// category. Delivery rules have no ID: they are identified by their name
+// and evaluated in list order.
+type DeliveryRuleBase struct {
+	Name    string `json:"rule_name"`
+	Action  string `json:"action"`
+	Filter  string `json:"filter,omitempty"`
+	Enabled *bool  `json:"enabled,omitempty"` // true when omitted
+}
+
+// Category returns the category of the rule, derived from its action.
+func (b DeliveryRuleBase) Category() DeliveryCategory {
+	return deliveryActions[b.Action]
+}
+
+// IsEnabled reports whether the rule is enabled. Rules are enabled unless
+// Enabled is explicitly false.
+func (b DeliveryRuleBase) IsEnabled() bool {
+	return b.Enabled == nil || *b.Enabled
+}
+
+func (b DeliveryRuleBase) base() DeliveryRuleBase { return b }
+
+// RedirectRule is a rule of the REDIRECT and SIMPLIFIED_REDIRECT categories.
+// Simplified redirects match on From alone and have no filter.
+type RedirectRule struct {
+	DeliveryRuleBase
+	From         string `json:"from,omitempty"`
+	To           string `json:"to,omitempty"`
+	ResponseCode int    `json:"response_code,omitempty"` // 301, 302, 303, 307 or 308
+}
+
+// RewriteRule is a rule of the REWRITE category, rewriting or deleting the
+// URL, a header or a cookie of the request.
+type RewriteRule struct {
+	DeliveryRuleBase
+	From                    string `json:"from,omitempty"`
+	To                      string `json:"to,omitempty"`
+	HeaderName              string `json:"header_name,omitempty"`
+	CookieName              string `json:"cookie_name,omitempty"`
+	RewriteExisting         *bool  `json:"rewrite_existing,omitempty"`
+	AddMissing              *bool  `json:"add_missing,omitempty"`
+	MultipleHeadersDeletion *bool  `json:"multiple_headers_deletion,omitempty"`
+}
+
+// ResponseRewriteRule is a rule of the REWRITE_RESPONSE category, rewriting
+// a response header or code, or answering with a custom error response.
+type ResponseRewriteRule struct {
+	DeliveryRuleBase
+	From                    string `json:"from,omitempty"`
+	To                      string `json:"to,omitempty"`
+	HeaderName              string `json:"header_name,omitempty"`
+	RewriteExisting         *bool  `json:"rewrite_existing,omitempty"`
+	AddMissing              *bool  `json:"add_missing,omitempty"`
+	MultipleHeadersDeletion *bool  `json:"multiple_headers_deletion,omitempty"`
+	ResponseCode            int    `json:"response_code,omitempty"`
+	ErrorType               string `json:"error_type,omitempty"`
+	ErrorResponseFormat     string `json:"error_response_format,omitempty"` // json or xml
+	ErrorResponseData       string `json:"error_response_data,omitempty"`
+}
+
+// ForwardRule is a rule of the FORWARD category, forwarding requests to a
+// data center or a port.
+type ForwardRule struct {
+	DeliveryRuleBase
+	DCID                  int    `json:"dc_id,omitempty"`
+	PortForwardingContext string `json:"port_forwarding_context,omitempty"` // "Use Port Value" or "Use Header Name"
+	PortForwardingValue   string `json:"port_forwarding_value,omitempty"`
+}
+
+// DeliveryRule is a delivery rule of any category: a RedirectRule,
+// RewriteRule, ResponseRewriteRule or ForwardRule.
+type DeliveryRule interface {
+	Category() DeliveryCategory
+	IsEnabled() bool
+	base() DeliveryRuleBase
+}
+
+// DeliveryRules is the delivery rule configuration of a site, one ordered
+// list per category.
+type DeliveryRules struct {
+	Redirect           []RedirectRule
+	SimplifiedRedirect []RedirectRule
+	Rewrite            []RewriteRule
+	RewriteResponse    []ResponseRewriteRule
+	Forward            []ForwardRule
+}
+
+// All returns the rules of every category, in category then list order.
+func (d *DeliveryRules) All() []DeliveryRule {
+	var all []DeliveryRule
+	for _, r := range d.Redirect {
+		all = append(all, r)
+	}
+	for _, r := range d.SimplifiedRedirect {
+		all = append(all, r)
+	}
+	for _, r := range d.Rewrite {
+		all = append(all, r)
+	}
+	for _, r := range d.RewriteResponse {
+		all = append(all, r)
+	}
+	for _, r := range d.Forward {
+		all = append(all, r)
+	}
+	return all
+}
+
+// deliveryRulesList is the body of the delivery rules configuration endpoint.
+type deliveryRulesList[T DeliveryRule] struct {
+	RulesList []T `json:"rules_list"`
+}
+
+type deliveryRulesResponse[T DeliveryRule] struct {
+	Data []deliveryRulesList[T] `json:"data"`
+}
+
+func deliveryRulesPath(siteID int, category DeliveryCategory) string {
+	return fmt.Sprintf("/api/prov/v3/sites/%d/delivery-rules-configuration?category=%s", siteID, url.QueryEscape(string(category)))
+}
+
+// getDeliveryRules reads the rules of one category.
+func getDeliveryRules[T DeliveryRule](ctx context.Context, c *Client, siteID int, category DeliveryCategory) ([]T, error) {
+	respBody, err := c.GetContext(ctx, deliveryRulesPath(siteID, category))
+	if err != nil {
+		return nil, err
+	}
+	return decodeDeliveryRules[T](respBody, category)
+}
+
+// setDeliveryRules replaces the rules of one category with rules.
+func setDeliveryRules[T DeliveryRule](ctx context.Context, c *Client, siteID int, category DeliveryCategory, rules []T) ([]T, error) {
+	for _, r := range rules {
+		b := r.base()
+		if b.Name == "" {
+			return nil, fmt.Errorf("%s delivery rule without a name", category)
+		}
+		if r.Category() != category {
+			return nil, fmt.Errorf("delivery rule %q: action %s does not belong to category %s", b.Name, b.Action, category)
+		}
+	}
+	if rules == nil {
+		rules = []T{}
+	}
+	// The list replaces the whole category, so the request can be retried.
+	respBody, err := c.PostContext(WithRetry(ctx), deliveryRulesPath(siteID, category), deliveryRulesList[T]{RulesList: rules})
+	if err != nil {
+		return nil, err
+	}
+	return decodeDeliveryRules[T](respBody, category)
+}
+
+func decodeDeliveryRules[T DeliveryRule](respBody []byte, category DeliveryCategory) ([]T, error) {
+	var resp deliveryRulesResponse[T]
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s delivery rules response: %w", category, err)
+	}
+	var rules []T
+	for _, d := range resp.Data {
+		rules = append(rules, d.RulesList...)
+	}
+	return rules, nil
+}
+
+// categoriesOrAll returns categories, or every category when empty.
+func categoriesOrAll(categories []DeliveryCategory) []DeliveryCategory {
+	if len(categories) == 0 {
+		return deliveryCategories
+	}
+	return categories
+}
+
+// GetDeliveryRules reads the delivery rules of a site, restricted to the
+// given categories if any.
+func (c *Client) GetDeliveryRules(siteID int, categories ...DeliveryCategory) (*DeliveryRules, error) {
+	return c.GetDeliveryRulesContext(context.Background(), siteID, categories...)
+}
+
+// GetDeliveryRulesContext is like GetDeliveryRules but carries ctx for cancellation and deadlines.
+func (c *Client) GetDeliveryRulesContext(ctx context.Context, siteID int, categories ...DeliveryCategory) (*DeliveryRules, error) {
+	rules := &DeliveryRules{}
+	for _, category := range categoriesOrAll(categories) {
+		var err error
+		switch category {
+		case DeliveryRedirect:
+			rules.Redirect, err = getDeliveryRules[RedirectRule](ctx, c, siteID, category)
+		case DeliverySimplifiedRedirect:
+			rules.SimplifiedRedirect, err = getDeliveryRules[RedirectRule](ctx, c, siteID, category)
+		case DeliveryRewrite:
+			rules.Rewrite, err = getDeliveryRules[RewriteRule](ctx, c, siteID, category)
+		case DeliveryRewriteResponse:
+			rules.RewriteResponse, err = getDeliveryRules[ResponseRewriteRule](ctx, c, siteID, category)
+		case DeliveryForward:
+			rules.Forward, err = getDeliveryRules[ForwardRule](ctx, c, siteID, category)
+		default:
+			err = fmt.Errorf("unknown delivery rule category %q", category)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+// SetDeliveryRules replaces the delivery rules of a site with rules, for
+// the given categories or, when none is given, for the categories whose
+// list in rules is not nil. Rules missing from the list of a replaced
+// category are deleted. It returns the rules of the replaced categories as
+// stored by the API. See AddDeliveryRule, UpdateDeliveryRule and
+// DeleteDeliveryRule to change a single rule.
+func (c *Client) SetDeliveryRules(siteID int, rules *DeliveryRules, categories ...DeliveryCategory) (*DeliveryRules, error) {
+	return c.SetDeliveryRulesContext(context.Background(), siteID, rules, categories...)
+}
+
+// SetDeliveryRulesContext is like SetDeliveryRules but carries ctx for cancellation and deadlines.
+func (c *Client) SetDeliveryRulesContext(ctx context.Context, siteID int, rules *DeliveryRules, categories ...DeliveryCategory) (*DeliveryRules, error) {
+	if rules == nil {
+		return nil, fmt.Errorf("set delivery rules of site %d: nil rules", siteID)
+	}
+	if len(categories) == 0 {
+		categories = rules.listed()
+	}
+	stored := &DeliveryRules{}
+	for _, category := range categories {
+		var err error
+		switch category {
+		case DeliveryRedirect:
+			stored.Redirect, err = setDeliveryRules(ctx, c, siteID, category, rules.Redirect)
+		case DeliverySimplifiedRedirect:
+			stored.SimplifiedRedirect, err = setDeliveryRules(ctx, c, siteID, category, rules.SimplifiedRedirect)
+		case DeliveryRewrite:
+			stored.Rewrite, err = setDeliveryRules(ctx, c, siteID, category, rules.Rewrite)
+		case DeliveryRewriteResponse:
+			stored.RewriteResponse, err = setDeliveryRules(ctx, c, siteID, category, rules.RewriteResponse)
+		case DeliveryForward:
+			stored.Forward, err = setDeliveryRules(ctx, c, siteID, category, rules.Forward)
+		default:
+			err = fmt.Errorf("unknown delivery rule category %q", category)
+		}
+		if err != nil {
+			return stored, fmt.Errorf("set %s delivery rules of site %d: %w", category, siteID, err)
+		}
+	}
+	return stored, nil
+}
+
+// listed returns the categories whose list is not nil.
+func (d *DeliveryRules) listed() []DeliveryCategory {
+	var categories []DeliveryCategory
+	for _, category := range deliveryCategories {
+		var listed bool
+		switch category {
+		case DeliveryRedirect:
+			listed = d.Redirect != nil
+		case DeliverySimplifiedRedirect:
+			listed = d.SimplifiedRedirect != nil
+		case DeliveryRewrite:
+			listed = d.Rewrite != nil
+		case DeliveryRewriteResponse:
+			listed = d.RewriteResponse != nil
+		case DeliveryForward:
+			listed = d.Forward != nil
+		}
+		if listed {
+			categories = append(categories, category)
+		}
+	}
+	return categories
+}
+
+// add appends r to the list of its category.
+func (d *DeliveryRules) add(r DeliveryRule) error {
+	ok := false
+	switch r := r.(type) {
+	case RedirectRule:
+		switch r.Category() {
+		case DeliveryRedirect:
+			d.Redirect, ok = append(d.Redirect, r), true
+		case DeliverySimplifiedRedirect:
+			d.SimplifiedRedirect, ok = append(d.SimplifiedRedirect, r), true
+		}
+	case RewriteRule:
+		if r.Category() == DeliveryRewrite {
+			d.Rewrite, ok = append(d.Rewrite, r), true
+		}
+	case ResponseRewriteRule:
+		if r.Category() == DeliveryRewriteResponse {
+			d.RewriteResponse, ok = append(d.RewriteResponse, r), true
+		}
+	case ForwardRule:
+		if r.Category() == DeliveryForward {
+			d.Forward, ok = append(d.Forward, r), true
+		}
+	}
+	if !ok {
+		b := r.base()
+		return fmt.Errorf("delivery rule %q: action %s does not belong to a %T", b.Name, b.Action, r)
+	}
+	return nil
+}
+
+// editDeliveryRules reads the rules of a category, edits them and writes
+// them back. It returns the rule named name as stored, if any.
+func (c *Client) editDeliveryRules(ctx context.Context, siteID int, category DeliveryCategory, name string, edit func([]DeliveryRule) ([]DeliveryRule, error)) (DeliveryRule, error) {
+	current, err := c.GetDeliveryRulesContext(ctx, siteID, category)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := edit(current.All())
+	if err != nil {
+		return nil, err
+	}
+	edited := &DeliveryRules{}
+	for _, r := range rules {
+		if err := edited.add(r); err != nil {
+			return nil, err
+		}
+	}
+	stored, err := c.SetDeliveryRulesContext(ctx, siteID, edited, category)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range stored.All() {
+		if r.base().Name == name {
+			return r, nil
+		}
+	}
+	return nil, nil
+}
+
+// indexDeliveryRule returns the index of the rule named name, failing with
+// ErrNotFound when there is none.
+func indexDeliveryRule(rules []DeliveryRule, category DeliveryCategory, name string) (int, error) {
+	for i, r := range rules {
+		if r.base().Name == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("%s delivery rule %q: %w", category, name, ErrNotFound)
+}
+
+// categoryOf returns the category of rule, failing for non-delivery actions.
+func categoryOf(rule DeliveryRule) (DeliveryCategory, error) {
+	b := rule.base()
+	if _, ok := DeliveryCategoryOf(b.Action); !ok {
+		return "", fmt.Errorf("delivery rule %q: %s is not a delivery action", b.Name, b.Action)
+	}
+	return rule.Category(), nil
+}
+
+// AddDeliveryRule appends rule to the rules of its category and returns it
+// as stored. Rule names must be unique within a category. Like every
+// single-rule helper, it reads and rewrites the whole category, so
+// concurrent changes to the same category may be lost.
+func (c *Client) AddDeliveryRule(siteID int, rule DeliveryRule) (DeliveryRule, error) {
+	return c.AddDeliveryRuleContext(context.Background(), siteID, rule)
+}
+
+// AddDeliveryRuleContext is like AddDeliveryRule but carries ctx for cancellation and deadlines.
+func (c *Client) AddDeliveryRuleContext(ctx context.Context, siteID int, rule DeliveryRule) (DeliveryRule, error) {
+	category, err := categoryOf(rule)
+	if err != nil {
+		return nil, err
+	}
+	name := rule.base().Name
+	return c.editDeliveryRules(ctx, siteID, category, name, func(rules []DeliveryRule) ([]DeliveryRule, error) {
+		if _, err := indexDeliveryRule(rules, category, name); err == nil {
+			return nil, fmt.Errorf("%s delivery rule %q already exists", category, name)
+		}
+		return append(rules, rule), nil
+	})
+}
+
+// UpdateDeliveryRule replaces the rule named name, in the category of rule,
+// with rule, keeping its position. rule may rename it.
+func (c *Client) UpdateDeliveryRule(siteID int, name string, rule DeliveryRule) (DeliveryRule, error) {
+	return c.UpdateDeliveryRuleContext(context.Background(), siteID, name, rule)
+}
+
+// UpdateDeliveryRuleContext is like UpdateDeliveryRule but carries ctx for cancellation and deadlines.
+func (c *Client) UpdateDeliveryRuleContext(ctx context.Context, siteID int, name string, rule DeliveryRule) (DeliveryRule, error) {
+	category, err := categoryOf(rule)
+	if err != nil {
+		return nil, err
+	}
+	newName := rule.base().Name
+	return c.editDeliveryRules(ctx, siteID, category, newName, func(rules []DeliveryRule) ([]DeliveryRule, error) {
+		i, err := indexDeliveryRule(rules, category, name)
+		if err != nil {
+			return nil, err
+		}
+		if j, err := indexDeliveryRule(rules, category, newName); err == nil && j != i {
+			return nil, fmt.Errorf("%s delivery rule %q already exists", category, newName)
+		}
+		rules[i] = rule
+		return rules, nil
+	})
+}
+
+// DeleteDeliveryRule deletes the rule named name from a category.
+func (c *Client) DeleteDeliveryRule(siteID int, category DeliveryCategory, name string) error {
+	return c.DeleteDeliveryRuleContext(context.Background(), siteID, category, name)
+}
+
+// DeleteDeliveryRuleContext is like DeleteDeliveryRule but carries ctx for cancellation and deadlines.
+func (c *Client) DeleteDeliveryRuleContext(ctx context.Context, siteID int, category DeliveryCategory, name string) error {
+	_, err := c.editDeliveryRules(ctx, siteID, category, "", func(rules []DeliveryRule) ([]DeliveryRule, error) {
+		i, err := indexDeliveryRule(rules, category, name)
+		if err != nil {
+			return nil, err
+		}
+		return slices.Delete(rules, i, i+1), nil
+	})
+	return err
+}
+
+// DeliveryRuleStats is a delivery rule with its hit statistics.
+type DeliveryRuleStats struct {
+	Rule       DeliveryRule
+	Hits       float64           // total hits over the stats time range
+	Timeseries []TimeseriesPoint // hits over time, when requested
+}
+
+// deliveryStatsNames are the stats requested by GetDeliveryRuleStats when
+// StatsOptions.Stats is empty.
+const deliveryStatsNames = "delivery_rules,delivery_rules_timeseries"
+
+// JoinDeliveryRuleStats pairs rules with their entries in the
+// delivery_rules and delivery_rules_timeseries stats, matched by rule name.
+// Rules without stats get zero hits.
+func JoinDeliveryRuleStats(rules []DeliveryRule, stats *StatsResponse) []DeliveryRuleStats {
+	out := make([]DeliveryRuleStats, len(rules))
+	for i, r := range rules {
+		out[i].Rule = r
+		if stats == nil {
+			continue
+		}
+		name := r.base().Name
+		if d, ok := findStatsData(stats.DeliveryRules, name); ok {
+			for _, p := range d.Data {
+				out[i].Hits += p.Value
+			}
+		}
+		if d, ok := findStatsData(stats.DeliveryRulesTimeseries, name); ok {
+			out[i].Timeseries = d.Data
+		}
+	}
+	return out
+}
+
+func findStatsData(data []StatsData, name string) (StatsData, bool) {
+	for _, d := range data {
+		if d.Name == name {
+			return d, true
+		}
+	}
+	return StatsData{}, false
+}
+
+// GetDeliveryRuleStats lists the delivery rules of a site joined with their
+// hit statistics over opts.TimeRange. When opts.Stats is empty, the
+// delivery_rules and delivery_rules_timeseries stats are requested.
+func (c *Client) GetDeliveryRuleStats(siteID int, opts StatsOptions) ([]DeliveryRuleStats, error) {
+	return c.GetDeliveryRuleStatsContext(context.Background(), siteID, opts)
+}
+
+// GetDeliveryRuleStatsContext is like GetDeliveryRuleStats but carries ctx for cancellation and deadlines.
+func (c *Client) GetDeliveryRuleStatsContext(ctx context.Context, siteID int, opts StatsOptions) ([]DeliveryRuleStats, error) {
+	rules, err := c.GetDeliveryRulesContext(ctx, siteID)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Stats == "" {
+		opts.Stats = deliveryStatsNames
+	}
+	stats, err := c.GetStatsContext(ctx, siteID, opts)
+	if err != nil {
+		return nil, err
+	}
+	return JoinDeliveryRuleStats(rules.All(), stats), nil
+}
@@ -0,0 +1,155 @@
+package imperva_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"imperva-waf-client"
+	"imperva-waf-client/impervatest"
+)
+
+func TestDeliveryRules(t *testing.T) {
+	srv := impervatest.NewServer()
+	defer srv.Close()
+	srv.AddSite(imperva.Site{SiteID: 1})
+	client := srv.Client()
+
+	redirect := imperva.RedirectRule{
+		DeliveryRuleBase: imperva.DeliveryRuleBase{Name: "old blog", Action: imperva.RuleActionRedirect, Filter: `URL == "/blog"`},
+		From:             "/blog",
+		To:               "https://blog.example.com",
+		ResponseCode:     301,
+	}
+	forward := imperva.ForwardRule{
+		DeliveryRuleBase: imperva.DeliveryRuleBase{Name: "api", Action: imperva.RuleActionForwardToDC, Filter: `URL contains "/api"`},
+		DCID:             42,
+	}
+	if _, err := client.SetDeliveryRules(1, &imperva.DeliveryRules{
+		Redirect: []imperva.RedirectRule{redirect},
+		Forward:  []imperva.ForwardRule{forward},
+	}); err != nil {
+		t.Fatalf("SetDeliveryRules: %v", err)
+	}
+
+	got, err := client.GetDeliveryRules(1)
+	if err != nil {
+		t.Fatalf("GetDeliveryRules: %v", err)
+	}
+	if len(got.Redirect) != 1 || got.Redirect[0].To != redirect.To || got.Redirect[0].ResponseCode != 301 {
+		t.Errorf("redirect rules = %+v, want %+v", got.Redirect, redirect)
+	}
+	if len(got.Forward) != 1 || got.Forward[0].DCID != 42 || got.Forward[0].Category() != imperva.DeliveryForward {
+		t.Errorf("forward rules = %+v, want %+v", got.Forward, forward)
+	}
+
+	// Replacing one category leaves the others alone.
+	if _, err := client.SetDeliveryRules(1, &imperva.DeliveryRules{}, imperva.DeliveryRedirect); err != nil {
+		t.Fatalf("SetDeliveryRules(REDIRECT): %v", err)
+	}
+	if stored := srv.DeliveryRules(1); len(stored.Redirect) != 0 || len(stored.Forward) != 1 {
+		t.Errorf("server delivery rules = %+v, want the forward rule only", stored)
+	}
+
+	// Without categories, only the lists that are set are replaced.
+	if _, err := client.SetDeliveryRules(1, &imperva.DeliveryRules{Redirect: []imperva.RedirectRule{redirect}}); err != nil {
+		t.Fatalf("SetDeliveryRules(redirect list): %v", err)
+	}
+	if stored := srv.DeliveryRules(1); len(stored.Redirect) != 1 || len(stored.Forward) != 1 {
+		t.Errorf("server delivery rules = %+v, want the redirect and forward rules", stored)
+	}
+	if _, err := client.SetDeliveryRules(1, nil); err == nil {
+		t.Error("SetDeliveryRules with nil rules succeeded")
+	}
+
+	// A rule listed in the wrong category is refused before any request.
+	n := srv.RequestCount(http.MethodPost, "/api/prov/v3/sites/1/delivery-rules-configuration")
+	_, err = client.SetDeliveryRules(1, &imperva.DeliveryRules{Rewrite: []imperva.RewriteRule{{DeliveryRuleBase: redirect.DeliveryRuleBase}}}, imperva.DeliveryRewrite)
+	if err == nil {
+		t.Error("SetDeliveryRules with a redirect action in REWRITE succeeded")
+	}
+	srv.AssertCallCount(t, http.MethodPost, "/api/prov/v3/sites/1/delivery-rules-configuration", n)
+}
+
+func TestGetDeliveryRuleStats(t *testing.T) {
+	srv := impervatest.NewServer()
+	defer srv.Close()
+	srv.AddSite(imperva.Site{SiteID: 1})
+	srv.SetDeliveryRules(1, imperva.DeliveryRules{
+		Redirect: []imperva.RedirectRule{{DeliveryRuleBase: imperva.DeliveryRuleBase{Name: "old blog", Action: imperva.RuleActionRedirect}}},
+		Forward:  []imperva.ForwardRule{{DeliveryRuleBase: imperva.DeliveryRuleBase{Name: "api", Action: imperva.RuleActionForwardToDC}}},
+	})
+	srv.SetStats(1, imperva.StatsResponse{
+		DeliveryRules: []imperva.StatsData{{Name: "old blog", Data: []imperva.TimeseriesPoint{{Value: 3}, {Value: 4}}}},
+	})
+
+	stats, err := srv.Client().GetDeliveryRuleStats(1, imperva.StatsOptions{TimeRange: "last_7_days"})
+	if err != nil {
+		t.Fatalf("GetDeliveryRuleStats: %v", err)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("got %d rules, want 2", len(stats))
+	}
+	if stats[0].Rule.Category() != imperva.DeliveryRedirect || stats[0].Hits != 7 {
+		t.Errorf("redirect stats = %+v, want 7 hits", stats[0])
+	}
+	if stats[1].Rule.Category() != imperva.DeliveryForward || stats[1].Hits != 0 {
+		t.Errorf("forward stats = %+v, want no hits", stats[1])
+	}
+}
+
+func TestDeliveryRuleCRUD(t *testing.T) {
+	srv := impervatest.NewServer()
+	defer srv.Close()
+	srv.AddSite(imperva.Site{SiteID: 1})
+	forward := imperva.ForwardRule{DeliveryRuleBase: imperva.DeliveryRuleBase{Name: "api", Action: imperva.RuleActionForwardToDC}, DCID: 42}
+	srv.SetDeliveryRules(1, imperva.DeliveryRules{Forward: []imperva.ForwardRule{forward}})
+	client := srv.Client()
+
+	redirect := func(name, to string) imperva.RedirectRule {
+		return imperva.RedirectRule{
+			DeliveryRuleBase: imperva.DeliveryRuleBase{Name: name, Action: imperva.RuleActionRedirect, Filter: `URL == "/` + name + `"`},
+			From:             "/" + name,
+			To:               to,
+			ResponseCode:     301,
+		}
+	}
+	for _, r := range []imperva.RedirectRule{redirect("a", "/x"), redirect("b", "/y")} {
+		if _, err := client.AddDeliveryRule(1, r); err != nil {
+			t.Fatalf("AddDeliveryRule(%s): %v", r.Name, err)
+		}
+	}
+	if _, err := client.AddDeliveryRule(1, redirect("a", "/z")); err == nil {
+		t.Error("AddDeliveryRule with a duplicate name succeeded")
+	}
+	wrongType := imperva.RewriteRule{DeliveryRuleBase: redirect("c", "/z").DeliveryRuleBase}
+	if _, err := client.AddDeliveryRule(1, wrongType); err == nil {
+		t.Error("AddDeliveryRule of a redirect action as a RewriteRule succeeded")
+	}
+
+	updated, err := client.UpdateDeliveryRule(1, "a", redirect("c", "/z"))
+	if err != nil {
+		t.Fatalf("UpdateDeliveryRule: %v", err)
+	}
+	if r, ok := updated.(imperva.RedirectRule); !ok || r.Name != "c" || r.To != "/z" {
+		t.Errorf("UpdateDeliveryRule = %+v, want the renamed rule", updated)
+	}
+	if _, err := client.UpdateDeliveryRule(1, "missing", redirect("d", "/z")); !errors.Is(err, imperva.ErrNotFound) {
+		t.Errorf("UpdateDeliveryRule of a missing rule: err = %v, want ErrNotFound", err)
+	}
+
+	if err := client.DeleteDeliveryRule(1, imperva.DeliveryRedirect, "b"); err != nil {
+		t.Fatalf("DeleteDeliveryRule: %v", err)
+	}
+	if err := client.DeleteDeliveryRule(1, imperva.DeliveryRedirect, "b"); !errors.Is(err, imperva.ErrNotFound) {
+		t.Errorf("DeleteDeliveryRule of a missing rule: err = %v, want ErrNotFound", err)
+	}
+
+	stored := srv.DeliveryRules(1)
+	if len(stored.Redirect) != 1 || stored.Redirect[0].Name != "c" || stored.Redirect[0].To != "/z" {
+		t.Errorf("redirect rules = %+v, want only the updated rule", stored.Redirect)
+	}
+	if len(stored.Forward) != 1 || stored.Forward[0].DCID != 42 {
+		t.Errorf("forward rules = %+v, want them untouched", stored.Forward)
+	}
+}
@@ -0,0 +1,148 @@
+package imperva
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Sentinel errors matched by *APIError through errors.Is.
+var (
+	ErrInvalidInput = errors.New("imperva: invalid input")
+	ErrUnauthorized = errors.New("imperva: unauthorized")
+	ErrForbidden    = errors.New("imperva: forbidden")
+	ErrNotFound     = errors.New("imperva: not found")
+	ErrRateLimited  = errors.New("imperva: rate limited")
+	ErrServer       = errors.New("imperva: server error")
+)
+
+// Imperva "res" codes with a known meaning.
+const (
+	ResOK                  = 0
+	ResUnexpectedError     = 1
+	ResInvalidInput        = 2
+	ResUnauthorizedAPIKey  = 9403
+	ResAuthMissing         = 9411
+	ResUnknownSite         = 9413
+	ResFeatureNotPermitted = 9414
+	ResOperationNotAllowed = 9415
+)
+
+// ErrorDetail is an entry of the v3 "errors" array.
+type ErrorDetail struct {
+	Status int    `json:"status,omitempty"`
+	ID     string `json:"id,omitempty"`
+	Title  string `json:"title,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// UnmarshalJSON decodes an error entry, accepting a status sent either as
+// a number or as a string, as some v3 endpoints do.
+func (d *ErrorDetail) UnmarshalJSON(b []byte) error {
+	type plain ErrorDetail
+	var v struct {
+		plain
+		Status json.RawMessage `json:"status"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*d = ErrorDetail(v.plain)
+	d.Status, _ = lenientInt(v.Status)
+	return nil
+}
+
+// APIError describes a failed Imperva API call, either at the HTTP level
+// or through a non-zero "res" code in an otherwise successful response.
+type APIError struct {
+	Method     string
+	Path       string
+	StatusCode int // HTTP status code
+	Res        int // Imperva "res" code, 0 when absent
+	ResMessage string
+	DebugInfo  interface{}
+	Errors     []ErrorDetail // v3 "errors" array, if any
+	Body       []byte        // raw response body
+}
+
+func (e *APIError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "imperva: %s %s failed", e.Method, e.Path)
+	if e.StatusCode != 0 {
+		fmt.Fprintf(&b, ": HTTP %d", e.StatusCode)
+	}
+	if e.Res != 0 {
+		fmt.Fprintf(&b, ": res %d", e.Res)
+	}
+	if e.ResMessage != "" {
+		fmt.Fprintf(&b, ": %s", e.ResMessage)
+	} else if len(e.Body) > 0 {
+		body := string(e.Body)
+		if len(body) > 512 {
+			body = body[:512] + "..."
+		}
+		fmt.Fprintf(&b, ", body: %s", body)
+	}
+	return b.String()
+}
+
+// status returns the HTTP status code, falling back to the status of the
+// first v3 error when the API reported a failure with HTTP 200.
+func (e *APIError) status() int {
+	if e.StatusCode < 400 && len(e.Errors) > 0 && e.Errors[0].Status != 0 {
+		return e.Errors[0].Status
+	}
+	return e.StatusCode
+}
+
+// Is reports whether e falls into the category of the sentinel target.
+func (e *APIError) Is(target error) bool {
+	status := e.status()
+	switch target {
+	case ErrInvalidInput:
+		return status == http.StatusBadRequest || e.Res == ResInvalidInput
+	case ErrUnauthorized:
+		return status == http.StatusUnauthorized || e.Res == ResUnauthorizedAPIKey || e.Res == ResAuthMissing
+	case ErrForbidden:
+		return status == http.StatusForbidden || e.Res == ResFeatureNotPermitted || e.Res == ResOperationNotAllowed
+	case ErrNotFound:
+		return status == http.StatusNotFound || e.Res == ResUnknownSite
+	case ErrRateLimited:
+		return status == http.StatusTooManyRequests
+	case ErrServer:
+		return status >= 500 || e.Res == ResUnexpectedError
+	}
+	return false
+}
+
+// newHTTPError builds an APIError from an HTTP error response, picking up
+// the Imperva envelope fields when the body carries them.
+func newHTTPError(method, path string, statusCode int, body []byte) *APIError {
+	e := &APIError{
+		Method:     method,
+		Path:       path,
+		StatusCode: statusCode,
+		Body:       body,
+	}
+	if env, ok := parseEnvelope(body); ok {
+		e.Res = env.res()
+		e.ResMessage = env.message()
+		e.DebugInfo = env.DebugInfo
+		e.Errors = env.Errors
+	}
+	return e
+}
+
+// newResError builds an APIError from a non-zero "res" envelope.
+func newResError(method, path string, res APIResponse) *APIError {
+	return &APIError{
+		Method:     method,
+		Path:       path,
+		StatusCode: http.StatusOK,
+		Res:        res.Res,
+		ResMessage: res.ResMessage,
+		DebugInfo:  res.DebugInfo,
+	}
+}
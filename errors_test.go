@@ -0,0 +1,49 @@
+package imperva_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"imperva-waf-client"
+)
+
+func TestV3ErrorStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		code   int
+		body   string
+		status int
+		want   error
+	}{
+		{"number", http.StatusOK, `{"errors":[{"status":400,"detail":"invalid filter"}]}`, 400, imperva.ErrInvalidInput},
+		{"string", http.StatusOK, `{"errors":[{"status":"400","detail":"invalid filter"}]}`, 400, imperva.ErrInvalidInput},
+		{"string on HTTP error", http.StatusNotFound, `{"errors":[{"status":"404","detail":"no such rule"}]}`, 404, imperva.ErrNotFound},
+		{"undecodable status", http.StatusOK, `{"errors":[{"status":{"code":400},"detail":"invalid filter"}]}`, 0, nil},
+		{"undecodable entry", http.StatusOK, `{"errors":["invalid filter"]}`, 0, nil},
+	}
+	for _, tt := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.code)
+			w.Write([]byte(tt.body))
+		}))
+		client := imperva.NewClient(&imperva.Config{Host: srv.URL})
+		client.Retry = nil
+
+		_, err := client.ListRules(1)
+		srv.Close()
+
+		var apiErr *imperva.APIError
+		if !errors.As(err, &apiErr) {
+			t.Errorf("%s: err = %v, want an *APIError", tt.name, err)
+			continue
+		}
+		if len(apiErr.Errors) != 1 || apiErr.Errors[0].Status != tt.status {
+			t.Errorf("%s: errors = %+v, want one with status %d", tt.name, apiErr.Errors, tt.status)
+		}
+		if tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
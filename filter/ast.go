@@ -0,0 +1,189 @@
+// Package filter parses, validates and formats Imperva custom rule filter
+// expressions, such as
+//
+//	ClientIP == 1.2.3.4;10.0.0.0/8 & (URL contains "/admin" | CountryCode == CN)
+//
+// A filter is a list of conditions combined with & (and) and | (or), where &
+// binds tighter than |, and parentheses group sub-expressions. A condition is
+// a parameter, an operator and one or more values separated by ';'. Values
+// may be quoted with double quotes, in which case \" and \\ are escaped.
+// Parameters taking a name, such as Header, are written Header.Name.
+package filter
+
+import (
+	"strings"
+)
+
+// Pos is a byte offset in the source filter, starting at 0.
+type Pos int
+
+// NoPos is the position of nodes that were not parsed from source, such as
+// those created by the builder.
+const NoPos Pos = -1
+
+// Node is a node of a filter AST.
+type Node interface {
+	// Pos returns the position of the first character of the node.
+	Pos() Pos
+	// String returns the canonical form of the node.
+	String() string
+	node()
+}
+
+// LogicalOp is a boolean connective between two expressions.
+type LogicalOp int
+
+const (
+	And LogicalOp = iota
+	Or
+)
+
+func (op LogicalOp) String() string {
+	if op == Or {
+		return "|"
+	}
+	return "&"
+}
+
+// BinaryExpr is X & Y or X | Y.
+type BinaryExpr struct {
+	Op    LogicalOp
+	OpPos Pos
+	X, Y  Node
+}
+
+// ParenExpr is a parenthesized expression.
+type ParenExpr struct {
+	Lparen Pos
+	X      Node
+}
+
+// Condition compares a parameter against one or more values.
+type Condition struct {
+	Param    Param
+	ParamPos Pos
+	Op       Operator
+	OpPos    Pos
+	Values   []Value
+}
+
+// Param is a filter parameter, optionally qualified by a name (Header.Name).
+type Param struct {
+	Name string
+	Arg  string
+}
+
+// String returns the parameter with the canonical spelling of known names.
+func (p Param) String() string {
+	name := p.Name
+	if spec, ok := LookupParam(name); ok {
+		name = spec.Name
+	}
+	if p.Arg == "" {
+		return name
+	}
+	return name + "." + p.Arg
+}
+
+// Value is a condition operand.
+type Value struct {
+	Text   string // unescaped text
+	Quoted bool
+	Pos    Pos
+}
+
+// String returns the value as written in canonical form: quoted when it was
+// quoted in the source or when it cannot be written bare.
+func (v Value) String() string {
+	if v.Quoted || needsQuotes(v.Text) {
+		return Quote(v.Text)
+	}
+	return v.Text
+}
+
+func (e *BinaryExpr) Pos() Pos { return e.X.Pos() }
+func (e *ParenExpr) Pos() Pos  { return e.Lparen }
+func (c *Condition) Pos() Pos  { return c.ParamPos }
+
+func (*BinaryExpr) node() {}
+func (*ParenExpr) node()  {}
+func (*Condition) node()  {}
+
+func (e *BinaryExpr) String() string {
+	return operand(e.X, e.Op) + " " + e.Op.String() + " " + operand(e.Y, e.Op)
+}
+
+// operand formats x as a child of a parent op, adding the parentheses
+// needed when x is an | expression below an &.
+func operand(x Node, parent LogicalOp) string {
+	if b, ok := x.(*BinaryExpr); ok && parent == And && b.Op == Or {
+		return "(" + b.String() + ")"
+	}
+	return x.String()
+}
+
+func (e *ParenExpr) String() string {
+	return "(" + e.X.String() + ")"
+}
+
+func (c *Condition) String() string {
+	vals := make([]string, len(c.Values))
+	for i, v := range c.Values {
+		vals[i] = v.String()
+	}
+	return c.Param.String() + " " + c.Op.String() + " " + strings.Join(vals, ";")
+}
+
+// Quote returns s as a double-quoted filter value.
+func Quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		if r == '"' || r == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// needsQuotes reports whether s cannot be written as a bare value.
+func needsQuotes(s string) bool {
+	if s == "" {
+		return true
+	}
+	for _, r := range s {
+		if !isWordRune(r) || r == '\\' {
+			return true
+		}
+	}
+	return false
+}
+
+// Walk calls fn for every node of the tree rooted at n, in depth-first order.
+// Children are not visited when fn returns false.
+func Walk(n Node, fn func(Node) bool) {
+	if n == nil || !fn(n) {
+		return
+	}
+	switch n := n.(type) {
+	case *BinaryExpr:
+		Walk(n.X, fn)
+		Walk(n.Y, fn)
+	case *ParenExpr:
+		Walk(n.X, fn)
+	}
+}
+
+// Conditions returns every condition of the tree rooted at n, left to right.
+func Conditions(n Node) []*Condition {
+	var out []*Condition
+	Walk(n, func(n Node) bool {
+		if c, ok := n.(*Condition); ok {
+			out = append(out, c)
+		}
+		return true
+	})
+	return out
+}
@@ -0,0 +1,196 @@
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Field is a parameter a condition can be built on. Obtain one from the
+// parameter functions (ClientIP, URL, Header, ...) and call an operator
+// method on it to get an Expr:
+//
+//	f, err := filter.ClientIP().In("1.2.3.4", "10.0.0.0/8").
+//		And(filter.URL().Contains("/login")).
+//		Build()
+//
+// Values are escaped as needed, and parameter, operator and value
+// combinations are validated when the expression is built.
+type Field struct {
+	param Param
+}
+
+// Expr is a filter expression under construction.
+// Errors are accumulated and reported by Build.
+type Expr struct {
+	node Node
+	err  error
+}
+
+func field(name string) Field { return Field{param: Param{Name: name}} }
+
+// ClientIP returns the client IP parameter.
+func ClientIP() Field { return field(ParamClientIP) }
+
+// URL returns the request URL (path) parameter.
+func URL() Field { return field(ParamURL) }
+
+// QueryString returns the request query string parameter.
+func QueryString() Field { return field(ParamQueryString) }
+
+// Method returns the HTTP method parameter.
+func Method() Field { return field(ParamMethod) }
+
+// UserAgent returns the user agent parameter.
+func UserAgent() Field { return field(ParamUserAgent) }
+
+// Referrer returns the referrer parameter.
+func Referrer() Field { return field(ParamReferrer) }
+
+// CountryCode returns the client country code parameter.
+func CountryCode() Field { return field(ParamCountryCode) }
+
+// ASN returns the client autonomous system number parameter.
+func ASN() Field { return field(ParamASN) }
+
+// ClientID returns the Imperva client classification ID parameter.
+func ClientID() Field { return field(ParamClientID) }
+
+// Header returns the parameter for the value of the named request header.
+func Header(name string) Field { return Field{param: Param{Name: ParamHeader, Arg: name}} }
+
+// Cookie returns the parameter for the value of the named cookie.
+func Cookie(name string) Field { return Field{param: Param{Name: ParamCookie, Arg: name}} }
+
+// QueryParam returns the parameter for the value of the named request parameter.
+func QueryParam(name string) Field { return Field{param: Param{Name: ParamParam, Arg: name}} }
+
+// HeaderExists returns the parameter matching names of headers present in the request.
+func HeaderExists() Field { return field(ParamHeaderExists) }
+
+// CookieExists returns the parameter matching names of cookies present in the request.
+func CookieExists() Field { return field(ParamCookieExists) }
+
+// ParamExists returns the parameter matching names of request parameters present in the request.
+func ParamExists() Field { return field(ParamParamExists) }
+
+// cond builds a condition and validates it against the parameter spec.
+func (f Field) cond(op Operator, values ...string) Expr {
+	if len(values) == 0 {
+		return Expr{err: &ValidationError{Pos: NoPos, Msg: "operator " + op.String() + " on " + f.param.String() + " needs at least one value"}}
+	}
+
+	// Names of qualified parameters are bare words: they cannot be quoted.
+	if strings.ContainsFunc(f.param.Arg, func(r rune) bool { return !isWordRune(r) }) {
+		return Expr{err: &ValidationError{Pos: NoPos, Msg: fmt.Sprintf("invalid name %q for %s: names cannot contain spaces or any of &|();\"=!<>~", f.param.Arg, f.param.Name)}}
+	}
+
+	c := &Condition{Param: f.param, ParamPos: NoPos, Op: op, OpPos: NoPos}
+	spec, known := LookupParam(f.param.Name)
+	for _, v := range values {
+		c.Values = append(c.Values, Value{Text: v, Pos: NoPos, Quoted: !known || spec.Kind == KindString || spec.Kind == KindName})
+	}
+	return Expr{node: c, err: errors.Join(checkCondition(c)...)}
+}
+
+// Eq matches when the parameter equals v.
+func (f Field) Eq(v string) Expr { return f.cond(Equal, v) }
+
+// NotEq matches when the parameter differs from v.
+func (f Field) NotEq(v string) Expr { return f.cond(NotEqual, v) }
+
+// In matches when the parameter equals any of values.
+func (f Field) In(values ...string) Expr { return f.cond(Equal, values...) }
+
+// NotIn matches when the parameter equals none of values.
+func (f Field) NotIn(values ...string) Expr { return f.cond(NotEqual, values...) }
+
+// Contains matches when the parameter contains any of values.
+func (f Field) Contains(values ...string) Expr { return f.cond(Contains, values...) }
+
+// NotContains matches when the parameter contains none of values.
+func (f Field) NotContains(values ...string) Expr { return f.cond(NotContains, values...) }
+
+// Matches matches when the parameter matches the regular expression re.
+func (f Field) Matches(re string) Expr { return f.cond(Matches, re) }
+
+// NotMatches matches when the parameter does not match the regular expression re.
+func (f Field) NotMatches(re string) Expr { return f.cond(NotMatches, re) }
+
+// Gt matches when the numeric parameter is greater than n.
+func (f Field) Gt(n int64) Expr { return f.cond(Greater, strconv.FormatInt(n, 10)) }
+
+// Ge matches when the numeric parameter is greater than or equal to n.
+func (f Field) Ge(n int64) Expr { return f.cond(GreaterOrEqual, strconv.FormatInt(n, 10)) }
+
+// Lt matches when the numeric parameter is less than n.
+func (f Field) Lt(n int64) Expr { return f.cond(Less, strconv.FormatInt(n, 10)) }
+
+// Le matches when the numeric parameter is less than or equal to n.
+func (f Field) Le(n int64) Expr { return f.cond(LessOrEqual, strconv.FormatInt(n, 10)) }
+
+// And returns e & others.
+func (e Expr) And(others ...Expr) Expr { return combine(And, append([]Expr{e}, others...)) }
+
+// Or returns e | others.
+func (e Expr) Or(others ...Expr) Expr { return combine(Or, append([]Expr{e}, others...)) }
+
+// AllOf returns the conjunction of exprs.
+func AllOf(exprs ...Expr) Expr { return combine(And, exprs) }
+
+// AnyOf returns the disjunction of exprs.
+func AnyOf(exprs ...Expr) Expr { return combine(Or, exprs) }
+
+func combine(op LogicalOp, exprs []Expr) Expr {
+	var out Expr
+	var errs []error
+	for _, e := range exprs {
+		errs = append(errs, e.err)
+		if e.node == nil {
+			continue
+		}
+		if out.node == nil {
+			out.node = e.node
+			continue
+		}
+		out.node = &BinaryExpr{Op: op, OpPos: NoPos, X: out.node, Y: group(e.node, op)}
+	}
+	out.err = errors.Join(errs...)
+	if out.node == nil && out.err == nil {
+		out.err = &ValidationError{Pos: NoPos, Msg: "empty expression"}
+	}
+	return out
+}
+
+// group parenthesizes n when it is an expression of the same operator
+// appearing on the right-hand side, to keep the grouping the caller built.
+func group(n Node, op LogicalOp) Node {
+	if b, ok := n.(*BinaryExpr); ok && b.Op == op {
+		return &ParenExpr{Lparen: NoPos, X: n}
+	}
+	return n
+}
+
+// Node returns the AST of the expression.
+func (e Expr) Node() (Node, error) {
+	if e.err != nil {
+		return nil, e.err
+	}
+	return e.node, nil
+}
+
+// Build returns the filter string of the expression.
+func (e Expr) Build() (string, error) {
+	n, err := e.Node()
+	if err != nil {
+		return "", err
+	}
+	return n.String(), nil
+}
+
+// String returns the filter string, or an empty string if the expression is invalid.
+func (e Expr) String() string {
+	s, _ := e.Build()
+	return s
+}
@@ -0,0 +1,33 @@
+package filter
+
+import "testing"
+
+func TestBuildRoundTrips(t *testing.T) {
+	exprs := []Expr{
+		URL().Eq(`/a "quoted" path`),
+		Header("X-Forwarded-For").Contains("10.0.0.1").And(Method().In("GET", "POST")),
+		Cookie("session_id").NotEq("").Or(QueryParam("q").Matches(`^a|b$`)),
+		ClientIP().In("1.2.3.4", "10.0.0.0/8"),
+	}
+	for _, e := range exprs {
+		s, err := e.Build()
+		if err != nil {
+			t.Fatalf("Build: %v", err)
+		}
+		n, err := Parse(s)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", s, err)
+		}
+		if got := n.String(); got != s {
+			t.Errorf("Parse(%q).String() = %q", s, got)
+		}
+	}
+}
+
+func TestBuildRejectsInvalidNames(t *testing.T) {
+	for _, f := range []Field{Header("X&b"), Cookie("a b"), QueryParam(`q"`), Header("a=b")} {
+		if s, err := f.Eq("v").Build(); err == nil {
+			t.Errorf("Build() = %q, want an error for the name", s)
+		}
+	}
+}
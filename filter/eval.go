@@ -0,0 +1,252 @@
+package filter
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Attributes describes a request a filter is evaluated against.
+// Zero values mean the attribute is unknown.
+type Attributes struct {
+	ClientIP    string
+	CountryCode string
+	ASN         int
+	ClientID    int
+	URL         string // path, without query string
+	QueryString string
+	Method      string
+	UserAgent   string
+	Referrer    string
+	Headers     map[string]string // keys matched case-insensitively
+	Cookies     map[string]string
+	Params      map[string]string
+}
+
+// Program is a compiled filter ready for evaluation.
+type Program struct {
+	root    Node
+	regexps map[string]*regexp.Regexp
+}
+
+// Compile parses and validates src for evaluation. An empty filter
+// compiles to a program matching every request, as the API applies rules
+// without a filter to all traffic.
+func Compile(src string) (*Program, error) {
+	if strings.TrimSpace(src) == "" {
+		return &Program{}, nil
+	}
+	n, err := Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	return CompileNode(n)
+}
+
+// CompileNode validates n for evaluation.
+func CompileNode(n Node) (*Program, error) {
+	if err := Check(n); err != nil {
+		return nil, err
+	}
+	p := &Program{root: n, regexps: map[string]*regexp.Regexp{}}
+	for _, c := range Conditions(n) {
+		if c.Op != Matches && c.Op != NotMatches {
+			continue
+		}
+		for _, v := range c.Values {
+			// Check has already ensured the expression compiles.
+			p.regexps[v.Text] = regexp.MustCompile(v.Text)
+		}
+	}
+	return p, nil
+}
+
+// Match reports whether the filter matches a request with attributes a.
+func (p *Program) Match(a Attributes) bool {
+	if p.root == nil {
+		return true
+	}
+	return p.eval(p.root, &a)
+}
+
+// String returns the canonical form of the filter.
+func (p *Program) String() string {
+	if p.root == nil {
+		return ""
+	}
+	return p.root.String()
+}
+
+func (p *Program) eval(n Node, a *Attributes) bool {
+	switch n := n.(type) {
+	case *BinaryExpr:
+		if n.Op == And {
+			return p.eval(n.X, a) && p.eval(n.Y, a)
+		}
+		return p.eval(n.X, a) || p.eval(n.Y, a)
+	case *ParenExpr:
+		return p.eval(n.X, a)
+	case *Condition:
+		return p.evalCondition(n, a)
+	}
+	panic(fmt.Sprintf("filter: unexpected node %T", n))
+}
+
+func (p *Program) evalCondition(c *Condition, a *Attributes) bool {
+	spec, _ := LookupParam(c.Param.Name)
+
+	var subject string
+	var known bool
+	switch spec.Name {
+	case ParamClientIP:
+		subject, known = a.ClientIP, a.ClientIP != ""
+	case ParamCountryCode:
+		subject, known = a.CountryCode, a.CountryCode != ""
+	case ParamASN:
+		subject, known = strconv.Itoa(a.ASN), a.ASN != 0
+	case ParamClientID:
+		subject, known = strconv.Itoa(a.ClientID), a.ClientID != 0
+	case ParamURL:
+		subject, known = a.URL, a.URL != ""
+	case ParamQueryString:
+		subject, known = a.QueryString, a.QueryString != ""
+	case ParamMethod:
+		subject, known = a.Method, a.Method != ""
+	case ParamUserAgent:
+		subject, known = a.UserAgent, a.UserAgent != ""
+	case ParamReferrer:
+		subject, known = a.Referrer, a.Referrer != ""
+	case ParamHeader:
+		subject, known = lookup(a.Headers, c.Param.Arg)
+	case ParamCookie:
+		subject, known = lookup(a.Cookies, c.Param.Arg)
+	case ParamParam:
+		subject, known = lookup(a.Params, c.Param.Arg)
+	case ParamHeaderExists:
+		return existsMatch(c, a.Headers)
+	case ParamCookieExists:
+		return existsMatch(c, a.Cookies)
+	case ParamParamExists:
+		return existsMatch(c, a.Params)
+	}
+	// Conditions on attributes the request does not carry never match,
+	// whatever their operator.
+	if !known {
+		return false
+	}
+
+	matched := false
+	for _, v := range c.Values {
+		if p.compare(spec, c.Op, subject, v.Text) {
+			matched = true
+			break
+		}
+	}
+	if c.Op.Negated() {
+		return !matched
+	}
+	return matched
+}
+
+// compare evaluates the positive form of op between subject and value.
+func (p *Program) compare(spec ParamSpec, op Operator, subject, value string) bool {
+	switch op {
+	case Equal, NotEqual:
+		switch spec.Kind {
+		case KindIP:
+			return ipMatch(subject, value)
+		case KindCountry:
+			return strings.EqualFold(subject, value)
+		case KindNumber:
+			return numCompare(subject, value) == 0
+		}
+		if spec.Name == ParamMethod {
+			return strings.EqualFold(subject, value)
+		}
+		return subject == value
+	case Contains, NotContains:
+		return strings.Contains(subject, value)
+	case Matches, NotMatches:
+		return p.regexps[value].MatchString(subject)
+	case Greater:
+		return numCompare(subject, value) > 0
+	case GreaterOrEqual:
+		return numCompare(subject, value) >= 0
+	case Less:
+		return numCompare(subject, value) < 0
+	case LessOrEqual:
+		return numCompare(subject, value) <= 0
+	}
+	return false
+}
+
+func lookup(m map[string]string, name string) (string, bool) {
+	if v, ok := m[name]; ok {
+		return v, true
+	}
+	for k, v := range m {
+		if strings.EqualFold(k, name) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+func existsMatch(c *Condition, m map[string]string) bool {
+	matched := false
+	for _, v := range c.Values {
+		if _, ok := lookup(m, v.Text); ok {
+			matched = true
+			break
+		}
+	}
+	if c.Op.Negated() {
+		return !matched
+	}
+	return matched
+}
+
+// numCompare compares two integers given as strings. Validation guarantees
+// value parses; an unparsable subject compares as lower than anything.
+func numCompare(subject, value string) int {
+	a, err := strconv.ParseInt(subject, 10, 64)
+	if err != nil {
+		return -1
+	}
+	b, _ := strconv.ParseInt(value, 10, 64)
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// ipMatch reports whether ip is the address, in the CIDR block or in the
+// range given by pattern.
+func ipMatch(ip, pattern string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	if p, err := netip.ParseAddr(pattern); err == nil {
+		return p.Unmap() == addr
+	}
+	if p, err := netip.ParsePrefix(pattern); err == nil {
+		return p.Contains(addr)
+	}
+	lo, hi, ok := strings.Cut(pattern, "-")
+	if !ok {
+		return false
+	}
+	a, err1 := netip.ParseAddr(lo)
+	b, err2 := netip.ParseAddr(hi)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	return !addr.Less(a.Unmap()) && !b.Unmap().Less(addr)
+}
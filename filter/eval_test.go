@@ -0,0 +1,67 @@
+package filter
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	req := Attributes{
+		ClientIP:    "10.1.2.3",
+		CountryCode: "FR",
+		ASN:         1234,
+		URL:         "/admin/login",
+		Method:      "POST",
+		Headers:     map[string]string{"X-Test": "yes"},
+	}
+	tests := []struct {
+		filter string
+		want   bool
+	}{
+		{`ClientIP == 10.0.0.0/8`, true},
+		{`CountryCode == US;FR`, true},
+		{`URL contains "/admin" & Method == POST`, true},
+		{`URL != "/admin/login"`, false},
+		{`ASN != 5`, true},
+		{`Header.x-test == "yes"`, true},
+		{`UserAgent != "curl"`, false}, // unknown attribute
+	}
+	for _, tt := range tests {
+		p, err := Compile(tt.filter)
+		if err != nil {
+			t.Fatalf("Compile(%q): %v", tt.filter, err)
+		}
+		if got := p.Match(req); got != tt.want {
+			t.Errorf("Match(%q) = %v, want %v", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestUnknownAttributesNeverMatch(t *testing.T) {
+	for _, f := range []string{
+		`URL != "/x"`,
+		`Method != GET`,
+		`QueryString !contains "a"`,
+		`ClientIP != 1.2.3.4`,
+		`CountryCode != FR`,
+		`ASN != 5`,
+		`Header.X != "a"`,
+	} {
+		p, err := Compile(f)
+		if err != nil {
+			t.Fatalf("Compile(%q): %v", f, err)
+		}
+		if p.Match(Attributes{}) {
+			t.Errorf("Match(%q) on empty attributes = true, want false", f)
+		}
+	}
+}
+
+func TestEmptyFilterMatchesEverything(t *testing.T) {
+	for _, src := range []string{"", "  "} {
+		p, err := Compile(src)
+		if err != nil {
+			t.Fatalf("Compile(%q): %v", src, err)
+		}
+		if !p.Match(Attributes{}) || !p.Match(Attributes{URL: "/a", Method: "GET"}) {
+			t.Errorf("Compile(%q) does not match every request", src)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package filter
+
+import "strings"
+
+// Operator compares a parameter with its values.
+type Operator string
+
+const (
+	Equal          Operator = "=="
+	NotEqual       Operator = "!="
+	Greater        Operator = ">"
+	GreaterOrEqual Operator = ">="
+	Less           Operator = "<"
+	LessOrEqual    Operator = "<="
+	Contains       Operator = "contains"
+	NotContains    Operator = "!contains"
+	Matches        Operator = "~"
+	NotMatches     Operator = "!~"
+)
+
+func (op Operator) String() string { return string(op) }
+
+// Negated reports whether op is the negative form of a comparison.
+func (op Operator) Negated() bool {
+	switch op {
+	case NotEqual, NotContains, NotMatches:
+		return true
+	}
+	return false
+}
+
+// Kind is the type of values a parameter accepts.
+type Kind int
+
+const (
+	KindString  Kind = iota // free text
+	KindIP                  // IP address, CIDR block or a-b range
+	KindCountry             // ISO 3166 alpha-2 country code
+	KindNumber              // integer
+	KindName                // header, cookie or parameter name, for *Exists parameters
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindIP:
+		return "IP"
+	case KindCountry:
+		return "country code"
+	case KindNumber:
+		return "number"
+	case KindName:
+		return "name"
+	}
+	return "string"
+}
+
+// operators lists the operators allowed for each kind.
+var operators = map[Kind][]Operator{
+	KindString:  {Equal, NotEqual, Contains, NotContains, Matches, NotMatches},
+	KindIP:      {Equal, NotEqual},
+	KindCountry: {Equal, NotEqual},
+	KindNumber:  {Equal, NotEqual, Greater, GreaterOrEqual, Less, LessOrEqual},
+	KindName:    {Equal, NotEqual},
+}
+
+// ParamSpec describes a known filter parameter.
+type ParamSpec struct {
+	Name string
+	Kind Kind
+	// Qualified parameters take a name, as in Header.User-Agent.
+	Qualified bool
+}
+
+// Well-known parameter names.
+const (
+	ParamClientIP     = "ClientIP"
+	ParamURL          = "URL"
+	ParamQueryString  = "QueryString"
+	ParamMethod       = "Method"
+	ParamUserAgent    = "UserAgent"
+	ParamReferrer     = "Referrer"
+	ParamCountryCode  = "CountryCode"
+	ParamASN          = "ASN"
+	ParamClientID     = "ClientId"
+	ParamHeader       = "Header"
+	ParamCookie       = "Cookie"
+	ParamParam        = "Param"
+	ParamHeaderExists = "HeaderExists"
+	ParamCookieExists = "CookieExists"
+	ParamParamExists  = "ParamExists"
+)
+
+var params = map[string]ParamSpec{}
+
+func init() {
+	for _, p := range []ParamSpec{
+		{Name: ParamClientIP, Kind: KindIP},
+		{Name: ParamURL, Kind: KindString},
+		{Name: ParamQueryString, Kind: KindString},
+		{Name: ParamMethod, Kind: KindString},
+		{Name: ParamUserAgent, Kind: KindString},
+		{Name: ParamReferrer, Kind: KindString},
+		{Name: ParamCountryCode, Kind: KindCountry},
+		{Name: ParamASN, Kind: KindNumber},
+		{Name: ParamClientID, Kind: KindNumber},
+		{Name: ParamHeader, Kind: KindString, Qualified: true},
+		{Name: ParamCookie, Kind: KindString, Qualified: true},
+		{Name: ParamParam, Kind: KindString, Qualified: true},
+		{Name: ParamHeaderExists, Kind: KindName},
+		{Name: ParamCookieExists, Kind: KindName},
+		{Name: ParamParamExists, Kind: KindName},
+	} {
+		params[strings.ToLower(p.Name)] = p
+	}
+}
+
+// LookupParam returns the spec of a known parameter, matched case-insensitively.
+func LookupParam(name string) (ParamSpec, bool) {
+	p, ok := params[strings.ToLower(name)]
+	return p, ok
+}
+
+// Allows reports whether op can be used with the parameter.
+func (p ParamSpec) Allows(op Operator) bool {
+	for _, o := range operators[p.Kind] {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,292 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SyntaxError reports a malformed filter.
+type SyntaxError struct {
+	Pos Pos
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("filter: syntax error at column %d: %s", e.Pos+1, e.Msg)
+}
+
+// Parse parses a filter expression into an AST.
+func Parse(src string) (Node, error) {
+	p := &parser{src: src}
+	p.next()
+	if p.tok.kind == tokEOF {
+		return nil, &SyntaxError{Pos: 0, Msg: "empty filter"}
+	}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %s", p.tok)
+	}
+	return n, nil
+}
+
+// Format parses src and returns its canonical form.
+func Format(src string) (string, error) {
+	n, err := Parse(src)
+	if err != nil {
+		return "", err
+	}
+	return n.String(), nil
+}
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokAnd
+	tokOr
+	tokLparen
+	tokRparen
+	tokSemi
+	tokOp
+	tokWord   // bare word: parameter, value or word operator
+	tokString // quoted string
+	tokError
+)
+
+type token struct {
+	kind tokKind
+	pos  Pos
+	text string // unescaped for strings
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of filter"
+	case tokString:
+		return Quote(t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+type parser struct {
+	src string
+	off int
+	tok token
+	err *SyntaxError
+}
+
+func (p *parser) errorf(format string, args ...interface{}) *SyntaxError {
+	if p.err != nil {
+		return p.err
+	}
+	return &SyntaxError{Pos: p.tok.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func isSpace(r rune) bool { return unicode.IsSpace(r) }
+
+// isWordRune reports whether r can appear in a bare word.
+func isWordRune(r rune) bool {
+	return !isSpace(r) && !strings.ContainsRune(`&|();"=!<>~`, r)
+}
+
+// next scans the next token into p.tok.
+func (p *parser) next() {
+	for p.off < len(p.src) {
+		r, size := utf8.DecodeRuneInString(p.src[p.off:])
+		if !isSpace(r) {
+			break
+		}
+		p.off += size
+	}
+
+	start := p.off
+	tok := func(kind tokKind, n int) {
+		p.tok = token{kind: kind, pos: Pos(start), text: p.src[start : start+n]}
+		p.off = start + n
+	}
+
+	if p.off >= len(p.src) {
+		p.tok = token{kind: tokEOF, pos: Pos(start)}
+		return
+	}
+
+	rest := p.src[p.off:]
+	switch {
+	case strings.HasPrefix(rest, "&&"):
+		tok(tokAnd, 2)
+	case strings.HasPrefix(rest, "||"):
+		tok(tokOr, 2)
+	case rest[0] == '&':
+		tok(tokAnd, 1)
+	case rest[0] == '|':
+		tok(tokOr, 1)
+	case rest[0] == '(':
+		tok(tokLparen, 1)
+	case rest[0] == ')':
+		tok(tokRparen, 1)
+	case rest[0] == ';':
+		tok(tokSemi, 1)
+	case strings.HasPrefix(rest, "!contains") && !continuesWord(rest[len("!contains"):]):
+		tok(tokOp, len("!contains"))
+	case strings.HasPrefix(rest, "==") || strings.HasPrefix(rest, "!=") ||
+		strings.HasPrefix(rest, ">=") || strings.HasPrefix(rest, "<=") ||
+		strings.HasPrefix(rest, "!~"):
+		tok(tokOp, 2)
+	case rest[0] == '>' || rest[0] == '<' || rest[0] == '~':
+		tok(tokOp, 1)
+	case rest[0] == '"':
+		p.scanString()
+	default:
+		n := 0
+		for n < len(rest) {
+			r, size := utf8.DecodeRuneInString(rest[n:])
+			if !isWordRune(r) {
+				break
+			}
+			n += size
+		}
+		if n == 0 {
+			r, _ := utf8.DecodeRuneInString(rest)
+			p.tok = token{kind: tokError, pos: Pos(start), text: string(r)}
+			p.err = &SyntaxError{Pos: Pos(start), Msg: fmt.Sprintf("unexpected character %q", r)}
+			return
+		}
+		tok(tokWord, n)
+	}
+}
+
+func continuesWord(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return s != "" && isWordRune(r)
+}
+
+func (p *parser) scanString() {
+	start := p.off
+	var b strings.Builder
+	i := p.off + 1
+	for i < len(p.src) {
+		c := p.src[i]
+		switch c {
+		case '\\':
+			if i+1 >= len(p.src) {
+				i++
+				continue
+			}
+			b.WriteByte(p.src[i+1])
+			i += 2
+			continue
+		case '"':
+			p.tok = token{kind: tokString, pos: Pos(start), text: b.String()}
+			p.off = i + 1
+			return
+		}
+		b.WriteByte(c)
+		i++
+	}
+	p.tok = token{kind: tokError, pos: Pos(start)}
+	p.err = &SyntaxError{Pos: Pos(start), Msg: "unterminated quoted value"}
+	p.off = len(p.src)
+}
+
+// parseOr parses and-expressions separated by |.
+func (p *parser) parseOr() (Node, error) {
+	x, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == tokOr {
+		opPos := p.tok.pos
+		p.next()
+		y, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		x = &BinaryExpr{Op: Or, OpPos: opPos, X: x, Y: y}
+	}
+	return x, nil
+}
+
+// parseAnd parses primary expressions separated by &.
+func (p *parser) parseAnd() (Node, error) {
+	x, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == tokAnd {
+		opPos := p.tok.pos
+		p.next()
+		y, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		x = &BinaryExpr{Op: And, OpPos: opPos, X: x, Y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	switch p.tok.kind {
+	case tokLparen:
+		lparen := p.tok.pos
+		p.next()
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokRparen {
+			return nil, p.errorf("expected ')' to close '(' at column %d, found %s", lparen+1, p.tok)
+		}
+		p.next()
+		return &ParenExpr{Lparen: lparen, X: x}, nil
+	case tokWord:
+		return p.parseCondition()
+	case tokError:
+		return nil, p.err
+	}
+	return nil, p.errorf("expected parameter or '(', found %s", p.tok)
+}
+
+func (p *parser) parseCondition() (Node, error) {
+	c := &Condition{ParamPos: p.tok.pos}
+	name, arg, _ := strings.Cut(p.tok.text, ".")
+	if name == "" {
+		return nil, p.errorf("missing parameter name")
+	}
+	c.Param = Param{Name: name, Arg: arg}
+	p.next()
+
+	switch {
+	case p.tok.kind == tokOp:
+		c.Op = Operator(p.tok.text)
+	case p.tok.kind == tokWord && strings.EqualFold(p.tok.text, string(Contains)):
+		c.Op = Contains
+	case p.tok.kind == tokError:
+		return nil, p.err
+	default:
+		return nil, p.errorf("expected operator after %s, found %s", c.Param, p.tok)
+	}
+	c.OpPos = p.tok.pos
+	p.next()
+
+	for {
+		switch p.tok.kind {
+		case tokWord, tokString:
+			c.Values = append(c.Values, Value{Text: p.tok.text, Quoted: p.tok.kind == tokString, Pos: p.tok.pos})
+		case tokError:
+			return nil, p.err
+		default:
+			return nil, p.errorf("expected value after %s, found %s", c.Op, p.tok)
+		}
+		p.next()
+		if p.tok.kind != tokSemi {
+			return c, nil
+		}
+		p.next()
+	}
+}
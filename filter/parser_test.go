@@ -0,0 +1,192 @@
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		filter string
+		pos    Pos
+		msg    string
+	}{
+		{``, 0, "empty filter"},
+		{`   `, 0, "empty filter"},
+		{`URL`, 3, "expected operator after URL, found end of filter"},
+		{`URL @ 1`, 4, `expected operator after URL, found "@"`},
+		{`URL = 1`, 4, "unexpected character '='"},
+		{`URL ==`, 6, "expected value after ==, found end of filter"},
+		{`URL == /a; `, 11, "expected value after ==, found end of filter"},
+		{`URL == "/a`, 7, "unterminated quoted value"},
+		{`URL == "/a" &`, 13, "expected parameter or '(', found end of filter"},
+		{`== 1`, 0, `expected parameter or '(', found "=="`},
+		{`(URL == "/a"`, 12, "expected ')' to close '(' at column 1, found end of filter"},
+		{`URL == "/a")`, 11, `unexpected ")"`},
+		{`URL == 1 URL`, 9, `unexpected "URL"`},
+		{`ClientIP == 1.2.3.4 & (URL == "/a" | `, 37, "expected parameter or '(', found end of filter"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.filter)
+		var se *SyntaxError
+		if !errors.As(err, &se) {
+			t.Errorf("Parse(%q) = %v, want a *SyntaxError", tt.filter, err)
+			continue
+		}
+		if se.Pos != tt.pos || se.Msg != tt.msg {
+			t.Errorf("Parse(%q): error at %d %q, want at %d %q", tt.filter, se.Pos, se.Msg, tt.pos, tt.msg)
+		}
+		if col := fmt.Sprintf("column %d", tt.pos+1); !strings.Contains(err.Error(), col) {
+			t.Errorf("Parse(%q) = %q, want it to report %s", tt.filter, err, col)
+		}
+	}
+}
+
+// tree renders n with every binary expression parenthesized, to show how
+// the parser grouped it.
+func tree(n Node) string {
+	switch n := n.(type) {
+	case *BinaryExpr:
+		return "{" + tree(n.X) + " " + n.Op.String() + " " + tree(n.Y) + "}"
+	case *ParenExpr:
+		return "(" + tree(n.X) + ")"
+	case *Condition:
+		return n.Param.String()
+	}
+	return fmt.Sprintf("%T", n)
+}
+
+func TestParsePrecedence(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   string
+	}{
+		{`a == 1 | b == 2 & c == 3`, `{a | {b & c}}`},
+		{`a == 1 & b == 2 | c == 3`, `{{a & b} | c}`},
+		{`a == 1 & b == 2 & c == 3`, `{{a & b} & c}`},
+		{`a == 1 | b == 2 | c == 3`, `{{a | b} | c}`},
+		{`a == 1 && b == 2 || c == 3`, `{{a & b} | c}`},
+		{`(a == 1 | b == 2) & c == 3`, `{({a | b}) & c}`},
+		{`a == 1 & (b == 2 | c == 3)`, `{a & ({b | c})}`},
+	}
+	for _, tt := range tests {
+		n, err := Parse(tt.filter)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.filter, err)
+		}
+		if got := tree(n); got != tt.want {
+			t.Errorf("Parse(%q) = %s, want %s", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestParsePositions(t *testing.T) {
+	n, err := Parse(`URL == "/a" & (Method != GET;"POST")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	and := n.(*BinaryExpr)
+	url := and.X.(*Condition)
+	paren := and.Y.(*ParenExpr)
+	method := paren.X.(*Condition)
+
+	tests := []struct {
+		what      string
+		got, want Pos
+	}{
+		{"& operator", and.OpPos, 12},
+		{"URL parameter", url.ParamPos, 0},
+		{"URL operator", url.OpPos, 4},
+		{"URL value", url.Values[0].Pos, 7},
+		{"(", paren.Lparen, 14},
+		{"Method parameter", method.ParamPos, 15},
+		{"Method operator", method.OpPos, 22},
+		{"GET", method.Values[0].Pos, 25},
+		{`"POST"`, method.Values[1].Pos, 29},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s at %d, want %d", tt.what, tt.got, tt.want)
+		}
+	}
+}
+
+func TestParseValues(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   []Value
+	}{
+		{`URL == /a`, []Value{{Text: "/a", Pos: 7}}},
+		{`URL == "/a b"`, []Value{{Text: "/a b", Quoted: true, Pos: 7}}},
+		{`URL == "a\"b\\c"`, []Value{{Text: `a"b\c`, Quoted: true, Pos: 7}}},
+		{`URL == ""`, []Value{{Text: "", Quoted: true, Pos: 7}}},
+		{`CountryCode == US;"FR" ; DE`, []Value{{Text: "US", Pos: 15}, {Text: "FR", Quoted: true, Pos: 18}, {Text: "DE", Pos: 25}}},
+	}
+	for _, tt := range tests {
+		n, err := Parse(tt.filter)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.filter, err)
+		}
+		got := n.(*Condition).Values
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("Parse(%q) values = %+v, want %+v", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   string
+	}{
+		{`URL=="/a"&&Method==GET`, `URL == "/a" & Method == GET`},
+		{`a == 1 || b == 2`, `a == 1 | b == 2`},
+		{`URL CONTAINS x`, `URL contains x`},
+		{`URL !contains "x"`, `URL !contains "x"`},
+		{`URL == a\b`, `URL == "a\\b"`},
+		{`URL == "a\"b\\c"`, `URL == "a\"b\\c"`},
+		{`x == 1;"2" ; 3`, `x == 1;"2";3`},
+		{`(a == 1)`, `(a == 1)`},
+		{`a == 1 | (b == 2 & c == 3)`, `a == 1 | (b == 2 & c == 3)`},
+		{`  (a == 1 | b == 2)  &  c == 3 `, `(a == 1 | b == 2) & c == 3`},
+		{`Header.X-Y == z`, `Header.X-Y == z`},
+	}
+	for _, tt := range tests {
+		got, err := Format(tt.filter)
+		if err != nil {
+			t.Fatalf("Format(%q): %v", tt.filter, err)
+		}
+		if got != tt.want {
+			t.Errorf("Format(%q) = %q, want %q", tt.filter, got, tt.want)
+		}
+		again, err := Format(got)
+		if err != nil {
+			t.Fatalf("Format(%q): %v", got, err)
+		}
+		if again != got {
+			t.Errorf("Format is not idempotent: Format(%q) = %q", got, again)
+		}
+	}
+}
+
+func TestBinaryExprStringAddsParentheses(t *testing.T) {
+	// Built without ParenExpr, as a builder would: the | below the & must
+	// still be parenthesized to keep its meaning.
+	a, _ := Parse(`a == 1`)
+	b, _ := Parse(`b == 2`)
+	c, _ := Parse(`c == 3`)
+	n := &BinaryExpr{Op: And, X: &BinaryExpr{Op: Or, X: a, Y: b}, Y: c}
+	want := `(a == 1 | b == 2) & c == 3`
+	if got := n.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	back, err := Parse(n.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tree(back); got != `{({a | b}) & c}` {
+		t.Errorf("String() parses back as %s", got)
+	}
+}
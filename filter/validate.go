@@ -0,0 +1,127 @@
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ValidationError reports a well-formed filter using an unknown parameter,
+// an operator the parameter does not support or a malformed value.
+type ValidationError struct {
+	Pos Pos
+	Msg string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Pos == NoPos {
+		return "filter: invalid filter: " + e.Msg
+	}
+	return fmt.Sprintf("filter: invalid filter at column %d: %s", e.Pos+1, e.Msg)
+}
+
+// Validate parses src and checks it against the known parameters.
+// All problems are returned, joined with errors.Join; a syntax error is
+// returned alone as a *SyntaxError.
+func Validate(src string) error {
+	n, err := Parse(src)
+	if err != nil {
+		return err
+	}
+	return Check(n)
+}
+
+// Check validates an already parsed filter.
+func Check(n Node) error {
+	var errs []error
+	for _, c := range Conditions(n) {
+		errs = append(errs, checkCondition(c)...)
+	}
+	return errors.Join(errs...)
+}
+
+func checkCondition(c *Condition) []error {
+	spec, ok := LookupParam(c.Param.Name)
+	if !ok {
+		return []error{&ValidationError{Pos: c.ParamPos, Msg: fmt.Sprintf("unknown parameter %q", c.Param.Name)}}
+	}
+
+	var errs []error
+	switch {
+	case spec.Qualified && c.Param.Arg == "":
+		errs = append(errs, &ValidationError{Pos: c.ParamPos, Msg: fmt.Sprintf("parameter %s requires a name, as in %s.Name", spec.Name, spec.Name)})
+	case !spec.Qualified && c.Param.Arg != "":
+		errs = append(errs, &ValidationError{Pos: c.ParamPos, Msg: fmt.Sprintf("parameter %s does not take a name", spec.Name)})
+	}
+	if !spec.Allows(c.Op) {
+		errs = append(errs, &ValidationError{Pos: c.OpPos, Msg: fmt.Sprintf("operator %s cannot be used with %s", c.Op, spec.Name)})
+	}
+	for _, v := range c.Values {
+		if err := checkValue(spec, c.Op, v); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func checkValue(spec ParamSpec, op Operator, v Value) error {
+	invalid := func(format string, args ...interface{}) error {
+		return &ValidationError{Pos: v.Pos, Msg: fmt.Sprintf(format, args...)}
+	}
+
+	if op == Matches || op == NotMatches {
+		if _, err := regexp.Compile(v.Text); err != nil {
+			return invalid("invalid regular expression %s: %v", Quote(v.Text), err)
+		}
+		return nil
+	}
+
+	switch spec.Kind {
+	case KindIP:
+		if !ValidIP(v.Text) {
+			return invalid("%s is not an IP address, CIDR block or range", Quote(v.Text))
+		}
+	case KindCountry:
+		if len(v.Text) != 2 || !isUpperLetters(v.Text) {
+			return invalid("%s is not a two-letter upper-case country code", Quote(v.Text))
+		}
+	case KindNumber:
+		if _, err := strconv.ParseInt(v.Text, 10, 64); err != nil {
+			return invalid("%s is not an integer", Quote(v.Text))
+		}
+	case KindName:
+		if v.Text == "" {
+			return invalid("empty name")
+		}
+	}
+	return nil
+}
+
+func isUpperLetters(s string) bool {
+	for _, r := range s {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidIP reports whether s is an IP address, a CIDR block or an a-b range.
+func ValidIP(s string) bool {
+	if _, err := netip.ParseAddr(s); err == nil {
+		return true
+	}
+	if _, err := netip.ParsePrefix(s); err == nil {
+		return true
+	}
+	lo, hi, ok := strings.Cut(s, "-")
+	if !ok {
+		return false
+	}
+	a, err1 := netip.ParseAddr(lo)
+	b, err2 := netip.ParseAddr(hi)
+	return err1 == nil && err2 == nil && a.Is4() == b.Is4() && !b.Less(a)
+}
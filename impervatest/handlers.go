@@ -0,0 +1,447 @@
+package impervatest
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"imperva-waf-client"
+)
+
+func (s *Server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/prov/v1/sites/list", s.listSites)
+	mux.HandleFunc("POST /api/prov/v1/sites/status", s.siteStatus)
+	mux.HandleFunc("POST /api/prov/v2/sites/{siteId}/rules", s.createRule)
+	mux.HandleFunc("GET /api/prov/v2/sites/{siteId}/rules/{ruleId}", s.getRule)
+	mux.HandleFunc("POST /api/prov/v2/sites/{siteId}/rules/{ruleId}", s.updateRule)
+	mux.HandleFunc("PUT /api/prov/v2/sites/{siteId}/rules/{ruleId}", s.overwriteRule)
+	mux.HandleFunc("DELETE /api/prov/v2/sites/{siteId}/rules/{ruleId}", s.deleteRule)
+	mux.HandleFunc("GET /api/prov/v3/rules", s.listRules)
+	mux.HandleFunc("GET /api/prov/v3/sites/{siteId}/delivery-rules-configuration", s.getDeliveryRules)
+	mux.HandleFunc("POST /api/prov/v3/sites/{siteId}/delivery-rules-configuration", s.setDeliveryRules)
+	mux.HandleFunc("POST /v3/sites/{siteId}/sessions/{sessionId}/release", s.releaseSession)
+	mux.HandleFunc("POST /api/visits/v1", s.listVisits)
+	mux.HandleFunc("POST /api/stats/v1", s.getStats)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fault, err := s.record(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if s.APIID != "" && r.Header.Get("x-API-Id") != s.APIID ||
+			s.APIKey != "" && r.Header.Get("x-API-Key") != s.APIKey {
+			writeRes(w, http.StatusUnauthorized, imperva.ResUnauthorizedAPIKey, "Authentication missing or invalid")
+			return
+		}
+
+		if fault != nil {
+			if fault.Latency > 0 {
+				select {
+				case <-time.After(fault.Latency):
+				case <-r.Context().Done():
+					return
+				}
+			}
+			switch {
+			case fault.Res != 0:
+				writeRes(w, max(fault.StatusCode, http.StatusOK), fault.Res, fault.ResMessage)
+				return
+			case fault.StatusCode != 0:
+				writeRes(w, fault.StatusCode, imperva.ResUnexpectedError, http.StatusText(fault.StatusCode))
+				return
+			}
+		}
+
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// intParam parses an integer path or query value, answering 400 on failure.
+func intParam(w http.ResponseWriter, v, name string) (int, bool) {
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		writeRes(w, http.StatusBadRequest, imperva.ResInvalidInput, "invalid "+name)
+		return 0, false
+	}
+	return n, true
+}
+
+// pageParams returns page_size and page_num, with the given default size.
+func pageParams(r *http.Request, defaultSize int) (size, num int) {
+	size, num = defaultSize, 0
+	if v, err := strconv.Atoi(r.URL.Query().Get("page_size")); err == nil && v > 0 {
+		size = v
+	}
+	if v, err := strconv.Atoi(r.URL.Query().Get("page_num")); err == nil && v >= 0 {
+		num = v
+	}
+	return size, num
+}
+
+// page returns the bounds of page num in a slice of length n.
+func page(n, size, num int) (lo, hi int) {
+	lo = min(size*num, n)
+	hi = min(lo+size, n)
+	return lo, hi
+}
+
+func (s *Server) listSites(w http.ResponseWriter, r *http.Request) {
+	size, num := pageParams(r, 50)
+
+	s.mu.Lock()
+	var sites []imperva.Site
+	for _, site := range s.sites {
+		sites = append(sites, site)
+	}
+	s.mu.Unlock()
+
+	slices.SortFunc(sites, func(a, b imperva.Site) int { return a.SiteID - b.SiteID })
+	lo, hi := page(len(sites), size, num)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"res":         0,
+		"res_message": "OK",
+		"sites":       append([]imperva.Site{}, sites[lo:hi]...),
+	})
+}
+
+func (s *Server) siteStatus(w http.ResponseWriter, r *http.Request) {
+	siteID, ok := intParam(w, r.URL.Query().Get("site_id"), "site_id")
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	site, found := s.sites[siteID]
+	s.mu.Unlock()
+	if !found {
+		writeRes(w, http.StatusOK, imperva.ResUnknownSite, "Unknown/unauthorized site_id")
+		return
+	}
+
+	// The status response is the site object with the envelope fields mixed in.
+	b, _ := json.Marshal(site)
+	var out map[string]interface{}
+	json.Unmarshal(b, &out)
+	out["res"] = 0
+	out["res_message"] = "OK"
+	writeJSON(w, http.StatusOK, out)
+}
+
+// ruleSite checks that the site in the path exists and returns its ID.
+func (s *Server) ruleSite(w http.ResponseWriter, r *http.Request) (int, bool) {
+	siteID, ok := intParam(w, r.PathValue("siteId"), "siteId")
+	if !ok {
+		return 0, false
+	}
+	s.mu.Lock()
+	_, found := s.sites[siteID]
+	s.mu.Unlock()
+	if !found {
+		writeRes(w, http.StatusNotFound, imperva.ResUnknownSite, "Unknown/unauthorized site_id")
+		return 0, false
+	}
+	return siteID, true
+}
+
+// decodeRule decodes the rule of the request body over base, so fields
+// absent from the body keep their value in base.
+func decodeRule(w http.ResponseWriter, r *http.Request, base imperva.Rule) (imperva.Rule, bool) {
+	// Copy base deeply so decoding does not write through its pointers.
+	var rule imperva.Rule
+	b, _ := json.Marshal(base)
+	json.Unmarshal(b, &rule)
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		writeRes(w, http.StatusBadRequest, imperva.ResInvalidInput, "invalid rule: "+err.Error())
+		return rule, false
+	}
+	if rule.Name == "" || rule.Action == "" {
+		writeRes(w, http.StatusBadRequest, imperva.ResInvalidInput, "name and action are required")
+		return rule, false
+	}
+	return rule, true
+}
+
+func (s *Server) createRule(w http.ResponseWriter, r *http.Request) {
+	siteID, ok := s.ruleSite(w, r)
+	if !ok {
+		return
+	}
+	rule, ok := decodeRule(w, r, imperva.Rule{})
+	if !ok {
+		return
+	}
+
+	rule.ID = 0
+	if rule.Enabled == nil {
+		rule.Enabled = imperva.Bool(true)
+	}
+	s.mu.Lock()
+	rule = s.putRule(siteID, rule)
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, rule)
+}
+
+// lookupRule returns the rule designated by the path, answering 404 when missing.
+func (s *Server) lookupRule(w http.ResponseWriter, r *http.Request) (int, imperva.Rule, bool) {
+	siteID, ok := s.ruleSite(w, r)
+	if !ok {
+		return 0, imperva.Rule{}, false
+	}
+	ruleID, ok := intParam(w, r.PathValue("ruleId"), "ruleId")
+	if !ok {
+		return 0, imperva.Rule{}, false
+	}
+
+	s.mu.Lock()
+	rule, found := s.rules[siteID][ruleID]
+	s.mu.Unlock()
+	if !found {
+		writeRes(w, http.StatusNotFound, imperva.ResInvalidInput, "Rule not found")
+		return 0, imperva.Rule{}, false
+	}
+	return siteID, rule, true
+}
+
+func (s *Server) getRule(w http.ResponseWriter, r *http.Request) {
+	if _, rule, ok := s.lookupRule(w, r); ok {
+		writeJSON(w, http.StatusOK, rule)
+	}
+}
+
+func (s *Server) updateRule(w http.ResponseWriter, r *http.Request) {
+	siteID, existing, ok := s.lookupRule(w, r)
+	if !ok {
+		return
+	}
+	// Like the API, only the fields present in the body are updated.
+	rule, ok := decodeRule(w, r, existing)
+	if !ok {
+		return
+	}
+
+	rule.ID = existing.ID
+	s.mu.Lock()
+	rule = s.putRule(siteID, rule)
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, rule)
+}
+
+func (s *Server) overwriteRule(w http.ResponseWriter, r *http.Request) {
+	siteID, existing, ok := s.lookupRule(w, r)
+	if !ok {
+		return
+	}
+	// Unlike POST, PUT replaces the whole rule.
+	rule, ok := decodeRule(w, r, imperva.Rule{})
+	if !ok {
+		return
+	}
+
+	rule.ID = existing.ID
+	if rule.Enabled == nil {
+		rule.Enabled = imperva.Bool(true)
+	}
+	s.mu.Lock()
+	rule = s.putRule(siteID, rule)
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, rule)
+}
+
+func (s *Server) deleteRule(w http.ResponseWriter, r *http.Request) {
+	siteID, rule, ok := s.lookupRule(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	delete(s.rules[siteID], rule.ID)
+	s.mu.Unlock()
+	writeRes(w, http.StatusOK, 0, "OK")
+}
+
+func (s *Server) listRules(w http.ResponseWriter, r *http.Request) {
+	size, num := pageParams(r, 100)
+
+	var siteIDs []int
+	for _, v := range r.URL.Query()["siteIds"] {
+		for _, part := range strings.Split(v, ",") {
+			id, ok := intParam(w, strings.TrimSpace(part), "siteIds")
+			if !ok {
+				return
+			}
+			siteIDs = append(siteIDs, id)
+		}
+	}
+
+	type item struct {
+		Rule      imperva.Rule `json:"rule"`
+		SiteID    int          `json:"site_id"`
+		AccountID int          `json:"account_id"`
+	}
+	var items []item
+	s.mu.Lock()
+	for _, siteID := range siteIDs {
+		for _, rule := range s.sortedRules(siteID) {
+			items = append(items, item{Rule: rule, SiteID: siteID, AccountID: s.AccountID})
+		}
+	}
+	s.mu.Unlock()
+
+	lo, hi := page(len(items), size, num)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data": append([]item{}, items[lo:hi]...),
+		"meta": map[string]int{
+			"page_num":    num,
+			"page_size":   size,
+			"total_items": len(items),
+			"total_pages": (len(items) + size - 1) / size,
+		},
+	})
+}
+
+// deliveryCategory returns the known category of the category query
+// parameter, answering 400 otherwise.
+func deliveryCategory(w http.ResponseWriter, r *http.Request) (imperva.DeliveryCategory, bool) {
+	category := imperva.DeliveryCategory(r.URL.Query().Get("category"))
+	if _, ok := deliveryFields(&imperva.DeliveryRules{})[category]; !ok {
+		writeErrors(w, http.StatusBadRequest, "unknown delivery rule category "+string(category))
+		return "", false
+	}
+	return category, true
+}
+
+func (s *Server) writeDeliveryRules(w http.ResponseWriter, siteID int, category imperva.DeliveryCategory) {
+	s.mu.Lock()
+	rules := s.delivery[siteID][category]
+	s.mu.Unlock()
+	if rules == nil {
+		rules = json.RawMessage("[]")
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data": []map[string]json.RawMessage{{"rules_list": rules}},
+	})
+}
+
+func (s *Server) getDeliveryRules(w http.ResponseWriter, r *http.Request) {
+	siteID, ok := s.ruleSite(w, r)
+	if !ok {
+		return
+	}
+	category, ok := deliveryCategory(w, r)
+	if !ok {
+		return
+	}
+	s.writeDeliveryRules(w, siteID, category)
+}
+
+func (s *Server) setDeliveryRules(w http.ResponseWriter, r *http.Request) {
+	siteID, ok := s.ruleSite(w, r)
+	if !ok {
+		return
+	}
+	category, ok := deliveryCategory(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		RulesList []json.RawMessage `json:"rules_list"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeErrors(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	// Like the API, the list replaces the whole category.
+	for _, raw := range body.RulesList {
+		var rule imperva.DeliveryRuleBase
+		if err := json.Unmarshal(raw, &rule); err != nil {
+			writeErrors(w, http.StatusBadRequest, "invalid rule: "+err.Error())
+			return
+		}
+		if rule.Name == "" || rule.Category() != category {
+			writeErrors(w, http.StatusBadRequest, "rule_name is required and action must belong to category "+string(category))
+			return
+		}
+	}
+	rules, _ := json.Marshal(body.RulesList)
+	if body.RulesList == nil {
+		rules = nil
+	}
+
+	s.mu.Lock()
+	if s.delivery[siteID] == nil {
+		s.delivery[siteID] = map[imperva.DeliveryCategory]json.RawMessage{}
+	}
+	s.delivery[siteID][category] = rules
+	s.mu.Unlock()
+	s.writeDeliveryRules(w, siteID, category)
+}
+
+func (s *Server) releaseSession(w http.ResponseWriter, r *http.Request) {
+	siteID, ok := s.ruleSite(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	s.released = append(s.released, ReleasedSession{SiteID: siteID, SessionID: r.PathValue("sessionId")})
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data": []imperva.APIResponse{{Res: 0, ResMessage: "Session released"}},
+	})
+}
+
+// querySite returns the known site designated by the site_id query parameter.
+func (s *Server) querySite(w http.ResponseWriter, r *http.Request) (int, bool) {
+	siteID, ok := intParam(w, r.URL.Query().Get("site_id"), "site_id")
+	if !ok {
+		return 0, false
+	}
+	s.mu.Lock()
+	_, found := s.sites[siteID]
+	s.mu.Unlock()
+	if !found {
+		writeRes(w, http.StatusOK, imperva.ResUnknownSite, "Unknown/unauthorized site_id")
+		return 0, false
+	}
+	return siteID, true
+}
+
+func (s *Server) listVisits(w http.ResponseWriter, r *http.Request) {
+	siteID, ok := s.querySite(w, r)
+	if !ok {
+		return
+	}
+	size, num := pageParams(r, 10)
+
+	s.mu.Lock()
+	visits := s.visits[siteID]
+	s.mu.Unlock()
+
+	lo, hi := page(len(visits), size, num)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"res":         0,
+		"res_message": "OK",
+		"visits":      append([]imperva.Visit{}, visits[lo:hi]...),
+	})
+}
+
+func (s *Server) getStats(w http.ResponseWriter, r *http.Request) {
+	siteID, ok := s.querySite(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	stats := s.stats[siteID]
+	s.mu.Unlock()
+
+	stats.ResMessage = "OK"
+	writeJSON(w, http.StatusOK, stats)
+}
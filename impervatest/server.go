@@ -0,0 +1,326 @@
+// Package impervatest provides an in-process fake of the Imperva Cloud WAF API
+// for tests.
+//
+// The fake keeps sites, custom rules, delivery rules, visits and statistics in
+// memory, supports fault injection and records every request it receives:
+//
+//	srv := impervatest.NewServer()
+//	defer srv.Close()
+//	srv.AddSite(imperva.Site{SiteID: 1, Domain: "example.com"})
+//	client := srv.Client()
+//	rule, err := client.CreateRule(1, imperva.Rule{Name: "block", Action: imperva.RuleActionBlockIP})
+package impervatest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"imperva-waf-client"
+)
+
+// Server is a stateful fake Imperva API server. It is safe for concurrent use.
+type Server struct {
+	*httptest.Server
+
+	// APIID and APIKey, when set, are required on every request.
+	APIID  string
+	APIKey string
+	// AccountID is reported as the owner of sites and rules.
+	AccountID int
+
+	mu         sync.Mutex
+	sites      map[int]imperva.Site
+	rules      map[int]map[int]imperva.Rule                         // site ID -> rule ID -> rule
+	delivery   map[int]map[imperva.DeliveryCategory]json.RawMessage // site ID -> category -> rules list
+	nextRuleID int
+	visits     map[int][]imperva.Visit
+	stats      map[int]imperva.StatsResponse
+	released   []ReleasedSession
+	faults     []*Fault
+	requests   []Request
+}
+
+// Request is a request received by the server.
+type Request struct {
+	Method string
+	Path   string
+	Query  map[string][]string
+	Header http.Header
+	Body   []byte
+}
+
+// ReleasedSession records a call to the session release endpoint.
+type ReleasedSession struct {
+	SiteID    int
+	SessionID string
+}
+
+// Fault describes an error injected into matching requests.
+type Fault struct {
+	Method     string        // matches any method when empty
+	PathPrefix string        // matches any path when empty
+	Latency    time.Duration // delay before answering
+	StatusCode int           // HTTP status to answer with, e.g. 503
+	Res        int           // Imperva "res" code to answer with (HTTP 200 unless StatusCode is set)
+	ResMessage string
+	Times      int // number of requests affected, 0 for all
+
+	hits int
+}
+
+// NewServer starts a fake server. Callers must Close it.
+func NewServer() *Server {
+	s := &Server{
+		AccountID:  1,
+		sites:      map[int]imperva.Site{},
+		rules:      map[int]map[int]imperva.Rule{},
+		delivery:   map[int]map[imperva.DeliveryCategory]json.RawMessage{},
+		nextRuleID: 1000,
+		visits:     map[int][]imperva.Visit{},
+		stats:      map[int]imperva.StatsResponse{},
+	}
+	s.Server = httptest.NewServer(s.handler())
+	return s
+}
+
+// Client returns a client pointed at the server, with retries disabled so
+// injected faults surface immediately.
+func (s *Server) Client() *imperva.Client {
+	c := imperva.NewClient(&imperva.Config{
+		Host:   s.URL,
+		APIID:  s.APIID,
+		APIKey: s.APIKey,
+	})
+	c.Retry = nil
+	return c
+}
+
+// AddSite registers a site.
+func (s *Server) AddSite(site imperva.Site) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if site.AccountId == 0 {
+		site.AccountId = s.AccountID
+	}
+	if site.Status == "" {
+		site.Status = "fully_configured"
+	}
+	if site.Active == nil {
+		site.Active = "active"
+	}
+	s.sites[site.SiteID] = site
+}
+
+// AddRule stores a rule for siteID, assigning it an ID when it has none.
+func (s *Server) AddRule(siteID int, rule imperva.Rule) imperva.Rule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.putRule(siteID, rule)
+}
+
+func (s *Server) putRule(siteID int, rule imperva.Rule) imperva.Rule {
+	if rule.ID == 0 {
+		s.nextRuleID++
+		rule.ID = s.nextRuleID
+	}
+	if s.rules[siteID] == nil {
+		s.rules[siteID] = map[int]imperva.Rule{}
+	}
+	s.rules[siteID][rule.ID] = rule
+	return rule
+}
+
+// Rules returns the rules of siteID ordered by ID.
+func (s *Server) Rules(siteID int) []imperva.Rule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sortedRules(siteID)
+}
+
+func (s *Server) sortedRules(siteID int) []imperva.Rule {
+	var out []imperva.Rule
+	for _, r := range s.rules[siteID] {
+		out = append(out, r)
+	}
+	slices.SortFunc(out, func(a, b imperva.Rule) int { return a.ID - b.ID })
+	return out
+}
+
+// deliveryFields maps each delivery rule category to its list in d.
+func deliveryFields(d *imperva.DeliveryRules) map[imperva.DeliveryCategory]interface{} {
+	return map[imperva.DeliveryCategory]interface{}{
+		imperva.DeliveryRedirect:           &d.Redirect,
+		imperva.DeliverySimplifiedRedirect: &d.SimplifiedRedirect,
+		imperva.DeliveryRewrite:            &d.Rewrite,
+		imperva.DeliveryRewriteResponse:    &d.RewriteResponse,
+		imperva.DeliveryForward:            &d.Forward,
+	}
+}
+
+// SetDeliveryRules replaces the delivery rules of siteID with rules.
+func (s *Server) SetDeliveryRules(siteID int, rules imperva.DeliveryRules) {
+	stored := map[imperva.DeliveryCategory]json.RawMessage{}
+	for category, list := range deliveryFields(&rules) {
+		b, _ := json.Marshal(list)
+		if string(b) != "null" {
+			stored[category] = b
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delivery[siteID] = stored
+}
+
+// DeliveryRules returns the delivery rules of siteID.
+func (s *Server) DeliveryRules(siteID int) imperva.DeliveryRules {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var rules imperva.DeliveryRules
+	for category, list := range deliveryFields(&rules) {
+		if b := s.delivery[siteID][category]; b != nil {
+			json.Unmarshal(b, list)
+		}
+	}
+	return rules
+}
+
+// SetVisits sets the visits returned for siteID.
+func (s *Server) SetVisits(siteID int, visits []imperva.Visit) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.visits[siteID] = visits
+}
+
+// SetStats sets the statistics returned for siteID.
+func (s *Server) SetStats(siteID int, stats imperva.StatsResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats[siteID] = stats
+}
+
+// ReleasedSessions returns the sessions released so far.
+func (s *Server) ReleasedSessions() []ReleasedSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.released)
+}
+
+// InjectFault makes matching requests fail as described by f.
+// Faults are evaluated in the order they were injected.
+func (s *Server) InjectFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &f)
+}
+
+// ClearFaults removes every injected fault.
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+// Requests returns the requests received so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.requests)
+}
+
+// RequestCount returns how many requests matched method and path prefix.
+// An empty method matches any method.
+func (s *Server) RequestCount(method, pathPrefix string) int {
+	n := 0
+	for _, r := range s.Requests() {
+		if (method == "" || r.Method == method) && strings.HasPrefix(r.Path, pathPrefix) {
+			n++
+		}
+	}
+	return n
+}
+
+// AssertCalled fails t unless a request matched method and path prefix.
+func (s *Server) AssertCalled(t testing.TB, method, pathPrefix string) {
+	t.Helper()
+	if s.RequestCount(method, pathPrefix) == 0 {
+		t.Errorf("impervatest: expected a %s request to %s, got none", method, pathPrefix)
+	}
+}
+
+// AssertNotCalled fails t if a request matched method and path prefix.
+func (s *Server) AssertNotCalled(t testing.TB, method, pathPrefix string) {
+	t.Helper()
+	if n := s.RequestCount(method, pathPrefix); n != 0 {
+		t.Errorf("impervatest: expected no %s request to %s, got %d", method, pathPrefix, n)
+	}
+}
+
+// AssertCallCount fails t unless exactly want requests matched method and path prefix.
+func (s *Server) AssertCallCount(t testing.TB, method, pathPrefix string, want int) {
+	t.Helper()
+	if n := s.RequestCount(method, pathPrefix); n != want {
+		t.Errorf("impervatest: expected %d %s requests to %s, got %d", want, method, pathPrefix, n)
+	}
+}
+
+// record stores r and returns the fault to apply to it, if any.
+func (s *Server) record(r *http.Request) (*Fault, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, Request{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Query:  r.URL.Query(),
+		Header: r.Header.Clone(),
+		Body:   body,
+	})
+
+	for _, f := range s.faults {
+		if f.Method != "" && f.Method != r.Method {
+			continue
+		}
+		if !strings.HasPrefix(r.URL.Path, f.PathPrefix) {
+			continue
+		}
+		if f.Times > 0 && f.hits >= f.Times {
+			continue
+		}
+		f.hits++
+		fc := *f
+		return &fc, nil
+	}
+	return nil, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeRes(w http.ResponseWriter, status, res int, msg string) {
+	writeJSON(w, status, imperva.APIResponse{Res: res, ResMessage: msg})
+}
+
+// writeErrors answers with a v3 "errors" array.
+func writeErrors(w http.ResponseWriter, status int, detail string) {
+	writeJSON(w, status, map[string]interface{}{
+		"errors": []imperva.ErrorDetail{{Status: status, Title: http.StatusText(status), Detail: detail}},
+	})
+}
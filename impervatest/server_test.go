@@ -0,0 +1,170 @@
+package impervatest_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"imperva-waf-client"
+	"imperva-waf-client/impervatest"
+)
+
+func newServer(t *testing.T) (*impervatest.Server, *imperva.Client) {
+	t.Helper()
+	srv := impervatest.NewServer()
+	t.Cleanup(srv.Close)
+	srv.AddSite(imperva.Site{SiteID: 1, Domain: "example.com"})
+	return srv, srv.Client()
+}
+
+func TestRuleCRUD(t *testing.T) {
+	srv, client := newServer(t)
+
+	created, err := client.CreateRule(1, imperva.Rule{
+		Name:         "block admin",
+		Action:       imperva.RuleActionBlock,
+		Filter:       `URL == "/admin"`,
+		ResponseCode: 403,
+	})
+	if err != nil {
+		t.Fatalf("CreateRule: %v", err)
+	}
+	if created.ID == 0 || !created.IsEnabled() {
+		t.Fatalf("created rule = %+v, want an ID and enabled", created)
+	}
+
+	got, err := client.GetRule(1, created.ID)
+	if err != nil {
+		t.Fatalf("GetRule: %v", err)
+	}
+	if got.Name != "block admin" || got.Filter != `URL == "/admin"` || got.ResponseCode != 403 {
+		t.Errorf("GetRule = %+v, want the created rule", got)
+	}
+
+	updated, err := client.UpdateRule(1, created.ID, imperva.Rule{
+		Name:   "block admin",
+		Action: imperva.RuleActionBlock,
+		Filter: `URL == "/admin2"`,
+	})
+	if err != nil {
+		t.Fatalf("UpdateRule: %v", err)
+	}
+	// The update endpoint only changes the fields present in the body.
+	if updated.Filter != `URL == "/admin2"` || updated.ResponseCode != 403 {
+		t.Errorf("UpdateRule = %+v, want the new filter and the response code kept", updated)
+	}
+
+	if err := client.DeleteRule(1, created.ID); err != nil {
+		t.Fatalf("DeleteRule: %v", err)
+	}
+	if _, err := client.GetRule(1, created.ID); err == nil {
+		t.Error("GetRule after DeleteRule succeeded")
+	}
+	if rules := srv.Rules(1); len(rules) != 0 {
+		t.Errorf("server rules = %+v, want none", rules)
+	}
+
+	srv.AssertCallCount(t, http.MethodPost, "/api/prov/v2/sites/1/rules", 2)
+	srv.AssertCalled(t, http.MethodDelete, "/api/prov/v2/sites/1/rules/")
+}
+
+func TestRuleUnknownSite(t *testing.T) {
+	_, client := newServer(t)
+
+	_, err := client.CreateRule(2, imperva.Rule{Name: "x", Action: imperva.RuleActionBlock})
+	if !errors.Is(err, imperva.ErrNotFound) {
+		t.Errorf("CreateRule on an unknown site: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestListRulesPagination(t *testing.T) {
+	srv, client := newServer(t)
+	for i := range 250 {
+		srv.AddRule(1, imperva.Rule{Name: fmt.Sprintf("rule %d", i), Action: imperva.RuleActionBlock})
+	}
+
+	rules, err := client.ListRules(1)
+	if err != nil {
+		t.Fatalf("ListRules: %v", err)
+	}
+	if len(rules) != 250 {
+		t.Errorf("ListRules returned %d rules, want 250", len(rules))
+	}
+	seen := map[int]bool{}
+	for _, r := range rules {
+		if seen[r.ID] {
+			t.Fatalf("rule %d listed twice", r.ID)
+		}
+		seen[r.ID] = true
+	}
+	srv.AssertCallCount(t, http.MethodGet, "/api/prov/v3/rules", 3)
+}
+
+func TestListSitesPagination(t *testing.T) {
+	srv, client := newServer(t)
+	for id := 2; id <= 130; id++ {
+		srv.AddSite(imperva.Site{SiteID: id, Domain: fmt.Sprintf("site%d.example.com", id)})
+	}
+
+	sites, err := client.ListSites(map[string]string{"page_size": "50", "page_num": "2"})
+	if err != nil {
+		t.Fatalf("ListSites: %v", err)
+	}
+	if len(sites) != 30 {
+		t.Errorf("last page has %d sites, want 30", len(sites))
+	}
+
+	all, err := client.ListAllSites()
+	if err != nil {
+		t.Fatalf("ListAllSites: %v", err)
+	}
+	if len(all) != 130 {
+		t.Errorf("ListAllSites returned %d sites, want 130", len(all))
+	}
+}
+
+func TestFaultInjection(t *testing.T) {
+	srv, client := newServer(t)
+	srv.InjectFault(impervatest.Fault{
+		Method:     http.MethodPost,
+		PathPrefix: "/api/prov/v2/sites/1/rules",
+		StatusCode: http.StatusServiceUnavailable,
+		Times:      1,
+	})
+
+	rule := imperva.Rule{Name: "x", Action: imperva.RuleActionBlock}
+	if _, err := client.CreateRule(1, rule); !errors.Is(err, imperva.ErrServer) {
+		t.Fatalf("first CreateRule: err = %v, want ErrServer", err)
+	}
+	if _, err := client.CreateRule(1, rule); err != nil {
+		t.Fatalf("second CreateRule: %v, want the fault exhausted", err)
+	}
+
+	srv.InjectFault(impervatest.Fault{Res: imperva.ResFeatureNotPermitted, ResMessage: "not permitted"})
+	_, err := client.ListRules(1)
+	var apiErr *imperva.APIError
+	if !errors.As(err, &apiErr) || apiErr.Res != imperva.ResFeatureNotPermitted || !errors.Is(err, imperva.ErrForbidden) {
+		t.Fatalf("ListRules with a res fault: err = %v, want res %d", err, imperva.ResFeatureNotPermitted)
+	}
+
+	srv.ClearFaults()
+	if _, err := client.ListRules(1); err != nil {
+		t.Errorf("ListRules after ClearFaults: %v", err)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	srv, _ := newServer(t)
+	srv.APIID, srv.APIKey = "id", "key"
+
+	client := srv.Client()
+	if _, err := client.ListRules(1); err != nil {
+		t.Fatalf("ListRules with credentials: %v", err)
+	}
+
+	client.APIKey = "wrong"
+	if _, err := client.ListRules(1); !errors.Is(err, imperva.ErrUnauthorized) {
+		t.Errorf("ListRules with a wrong key: err = %v, want ErrUnauthorized", err)
+	}
+}
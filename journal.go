@@ -0,0 +1,241 @@
+package imperva
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// JournalOp is the kind of rule change recorded in a journal.
+type JournalOp string
+
+// JournalOp constants
+const (
+	JournalCreate JournalOp = "create"
+	JournalUpdate JournalOp = "update"
+	JournalDelete JournalOp = "delete"
+)
+
+// JournalEntry records a rule change made through the client.
+type JournalEntry struct {
+	Time     time.Time `json:"time"`
+	Op       JournalOp `json:"op"`
+	Actor    string    `json:"actor,omitempty"`
+	SiteID   int       `json:"site_id"`
+	RuleID   int       `json:"rule_id"`
+	RuleName string    `json:"rule_name,omitempty"`
+	Before   *Rule     `json:"before,omitempty"` // nil for creations, or when it could not be read
+	After    *Rule     `json:"after,omitempty"`  // nil for deletions
+}
+
+// JournalError reports a rule change that was applied but could not be
+// recorded in the journal. Methods returning it also return their result.
+type JournalError struct {
+	Op     JournalOp
+	SiteID int
+	RuleID int
+	Err    error
+}
+
+func (e *JournalError) Error() string {
+	return fmt.Sprintf("journal %s of rule %d: %v", e.Op, e.RuleID, e.Err)
+}
+
+func (e *JournalError) Unwrap() error { return e.Err }
+
+// isJournalError reports whether err only means a change was not journaled.
+func isJournalError(err error) bool {
+	var je *JournalError
+	return errors.As(err, &je)
+}
+
+// JournalSink stores journal entries.
+type JournalSink interface {
+	Record(ctx context.Context, e JournalEntry) error
+}
+
+// JournalFunc adapts a function to the JournalSink interface.
+type JournalFunc func(ctx context.Context, e JournalEntry) error
+
+// Record calls f(ctx, e).
+func (f JournalFunc) Record(ctx context.Context, e JournalEntry) error {
+	return f(ctx, e)
+}
+
+// FileJournal is a JournalSink appending entries to a JSON Lines file.
+// It is safe for concurrent use.
+type FileJournal struct {
+	Path string
+	mu   sync.Mutex
+}
+
+// NewFileJournal returns a journal writing to path, created on first use.
+func NewFileJournal(path string) *FileJournal {
+	return &FileJournal{Path: path}
+}
+
+// Record appends e to the file.
+func (j *FileJournal) Record(_ context.Context, e JournalEntry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	f, err := os.OpenFile(j.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Entries reads back the entries of the file, oldest first.
+func (j *FileJournal) Entries() ([]JournalEntry, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return LoadJournal(j.Path)
+}
+
+// ReadJournal decodes JSON Lines journal entries from r.
+func ReadJournal(r io.Reader) ([]JournalEntry, error) {
+	var entries []JournalEntry
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 16<<20)
+	for line := 1; sc.Scan(); line++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var e JournalEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return entries, fmt.Errorf("journal line %d: %w", line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, sc.Err()
+}
+
+// LoadJournal reads the journal file at path. A missing file is an empty journal.
+func LoadJournal(path string) ([]JournalEntry, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadJournal(f)
+}
+
+// RuleHistory returns the entries about rule ruleID of site siteID, oldest
+// first. A zero siteID matches every site.
+func RuleHistory(entries []JournalEntry, siteID, ruleID int) []JournalEntry {
+	var out []JournalEntry
+	for _, e := range entries {
+		if e.RuleID == ruleID && (siteID == 0 || e.SiteID == siteID) {
+			out = append(out, e)
+		}
+	}
+	sortEntries(out)
+	return out
+}
+
+// RuleHistoryByName returns the entries about the rules that were ever named
+// name on site siteID, including their changes under other names, oldest
+// first. A zero siteID matches every site.
+func RuleHistoryByName(entries []JournalEntry, siteID int, name string) []JournalEntry {
+	type ref struct{ site, rule int }
+	ids := map[ref]bool{}
+	for _, e := range entries {
+		if siteID != 0 && e.SiteID != siteID {
+			continue
+		}
+		if e.RuleName == name || e.Before != nil && e.Before.Name == name || e.After != nil && e.After.Name == name {
+			ids[ref{e.SiteID, e.RuleID}] = true
+		}
+	}
+
+	var out []JournalEntry
+	for _, e := range entries {
+		if ids[ref{e.SiteID, e.RuleID}] {
+			out = append(out, e)
+		}
+	}
+	sortEntries(out)
+	return out
+}
+
+func sortEntries(entries []JournalEntry) {
+	slices.SortStableFunc(entries, func(a, b JournalEntry) int { return a.Time.Compare(b.Time) })
+}
+
+type actorKey struct{}
+
+// WithActor sets the caller identity recorded in the journal for changes
+// made with ctx, overriding Client.Actor.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// actor returns the caller identity for ctx: WithActor, Client.Actor or the API ID.
+func (c *Client) actor(ctx context.Context) string {
+	if a, ok := ctx.Value(actorKey{}).(string); ok && a != "" {
+		return a
+	}
+	if c.Actor != "" {
+		return c.Actor
+	}
+	return c.APIID
+}
+
+// journalBefore reads the state of a rule about to change, when journaling.
+// Read failures are ignored: the change itself reports them.
+func (c *Client) journalBefore(ctx context.Context, siteID, ruleID int) *Rule {
+	if c.Journal == nil {
+		return nil
+	}
+	rule, err := c.GetRuleContext(ctx, siteID, ruleID)
+	if err != nil {
+		return nil
+	}
+	return rule
+}
+
+// journal records a successful rule change, when journaling.
+func (c *Client) journal(ctx context.Context, op JournalOp, siteID, ruleID int, before, after *Rule) error {
+	if c.Journal == nil {
+		return nil
+	}
+	e := JournalEntry{
+		Time:   time.Now().UTC(),
+		Op:     op,
+		Actor:  c.actor(ctx),
+		SiteID: siteID,
+		RuleID: ruleID,
+		Before: before,
+		After:  after,
+	}
+	switch {
+	case after != nil:
+		e.RuleName = after.Name
+	case before != nil:
+		e.RuleName = before.Name
+	}
+	if err := c.Journal.Record(ctx, e); err != nil {
+		return &JournalError{Op: op, SiteID: siteID, RuleID: ruleID, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package imperva_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"imperva-waf-client"
+	"imperva-waf-client/impervatest"
+)
+
+func TestJournalFailureKeepsResult(t *testing.T) {
+	srv := impervatest.NewServer()
+	defer srv.Close()
+	srv.AddSite(imperva.Site{SiteID: 1})
+	srv.AddSite(imperva.Site{SiteID: 2})
+	client := srv.Client()
+	errDiskFull := errors.New("disk full")
+	client.Journal = imperva.JournalFunc(func(context.Context, imperva.JournalEntry) error { return errDiskFull })
+
+	rule := imperva.Rule{Name: "block admin", Action: imperva.RuleActionBlock, Filter: `URL == "/admin"`}
+	created, err := client.CreateRule(1, rule)
+	var je *imperva.JournalError
+	if !errors.As(err, &je) || je.Op != imperva.JournalCreate || !errors.Is(err, errDiskFull) {
+		t.Fatalf("CreateRule: err = %v, want a JournalError", err)
+	}
+	if created == nil || je.RuleID != created.ID {
+		t.Fatalf("CreateRule = %+v, want the created rule along with the journal error", created)
+	}
+
+	// Bulk operations keep journal-only failures and do not roll them back.
+	results, err := client.CreateRuleOnSites([]int{1, 2}, imperva.Rule{Name: "bulk", Action: imperva.RuleActionBlock}, imperva.BulkOptions{Rollback: true})
+	if !errors.As(err, &je) {
+		t.Fatalf("CreateRuleOnSites: err = %v, want a JournalError", err)
+	}
+	for _, res := range results {
+		if !res.OK() || res.Rule == nil || res.RolledBack {
+			t.Errorf("site %d result = %+v, want the rule kept", res.SiteID, res)
+		}
+	}
+	if n := len(srv.Rules(2)); n != 1 {
+		t.Errorf("site 2 has %d rules, want the bulk rule kept", n)
+	}
+
+	// ApplyPlan keeps the rule and goes on with the next change.
+	desired := []imperva.Rule{{Name: "one", Action: imperva.RuleActionBlock}, {Name: "two", Action: imperva.RuleActionBlock}}
+	plan, err := client.PlanRules(2, desired, imperva.PlanOptions{})
+	if err != nil {
+		t.Fatalf("PlanRules: %v", err)
+	}
+	applied, err := client.ApplyPlan(plan, imperva.ApplyOptions{})
+	if !errors.As(err, &je) {
+		t.Fatalf("ApplyPlan: err = %v, want a JournalError", err)
+	}
+	for _, res := range applied {
+		if res.Skipped || res.Rule == nil {
+			t.Errorf("change %q result = %+v, want applied with its rule", res.Change.Name, res)
+		}
+	}
+}
+
+func TestExpireRulesWithFailingJournal(t *testing.T) {
+	srv := impervatest.NewServer()
+	defer srv.Close()
+	srv.AddSite(imperva.Site{SiteID: 1})
+	srv.AddRule(1, imperva.Rule{
+		Name:   imperva.TemporaryRuleName("block scanner", time.Now().Add(-time.Hour)),
+		Action: imperva.RuleActionBlockIP,
+		Filter: `ClientIP == 1.2.3.4`,
+	})
+	client := srv.Client()
+	client.Journal = imperva.JournalFunc(func(context.Context, imperva.JournalEntry) error { return errors.New("disk full") })
+
+	report, err := client.ExpireRules([]int{1}, imperva.ExpireOptions{})
+	if err != nil {
+		t.Fatalf("ExpireRules: %v", err)
+	}
+	if len(report.Expired) != 1 {
+		t.Fatalf("expired = %+v, want one rule", report.Expired)
+	}
+	exp := report.Expired[0]
+	var je *imperva.JournalError
+	if !exp.Deleted || !errors.As(exp.Err, &je) {
+		t.Errorf("expired rule = %+v, want deleted with a JournalError", exp)
+	}
+	if failed := report.Failed(); len(failed) != 0 {
+		t.Errorf("failed = %+v, want none", failed)
+	}
+	if rules := srv.Rules(1); len(rules) != 0 {
+		t.Errorf("site rules = %+v, want none", rules)
+	}
+}
+
+func TestApplyPlanChecksConvergenceDespiteJournalFailure(t *testing.T) {
+	srv := impervatest.NewServer()
+	defer srv.Close()
+	srv.AddSite(imperva.Site{SiteID: 1})
+	rule := srv.AddRule(1, imperva.Rule{Name: "block", Action: imperva.RuleActionBlock, Filter: `URL == "/admin"`})
+	client := srv.Client()
+	client.Journal = imperva.JournalFunc(func(context.Context, imperva.JournalEntry) error { return errors.New("disk full") })
+	// The API answers the overwrite with a rule that did not take the new filter.
+	client.Use(func(next imperva.Doer) imperva.Doer {
+		return imperva.DoerFunc(func(req *http.Request) (*http.Response, error) {
+			resp, err := next.Do(req)
+			if err == nil && req.Method == http.MethodPut {
+				resp.Body.Close()
+				body, _ := json.Marshal(rule)
+				resp.Body = io.NopCloser(bytes.NewReader(body))
+			}
+			return resp, err
+		})
+	})
+
+	desired := []imperva.Rule{
+		{Name: "block", Action: imperva.RuleActionBlock, Filter: `URL == "/private"`},
+		{Name: "other", Action: imperva.RuleActionBlock, Filter: `URL == "/other"`},
+	}
+	plan, err := client.PlanRules(1, desired, imperva.PlanOptions{})
+	if err != nil {
+		t.Fatalf("PlanRules: %v", err)
+	}
+	results, err := client.ApplyPlan(plan, imperva.ApplyOptions{})
+	var je *imperva.JournalError
+	if !errors.As(err, &je) || !strings.Contains(err.Error(), "not in its desired state") {
+		t.Fatalf("ApplyPlan: err = %v, want both the journal and the convergence errors", err)
+	}
+	if len(results) != 2 || !results[1].Skipped {
+		t.Errorf("results = %+v, want the plan stopped after the diverged update", results)
+	}
+}
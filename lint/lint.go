@@ -0,0 +1,299 @@
+// Package lint analyzes the custom rules of a site and reports duplicates,
+// shadowed and contradictory rules, overly broad blocks and other risky
+// patterns.
+//
+//	rules, _ := client.ListRules(siteID)
+//	for _, f := range lint.Lint(rules, lint.Options{}) {
+//		fmt.Println(f)
+//	}
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"imperva-waf-client"
+	"imperva-waf-client/filter"
+)
+
+// Severity ranks findings.
+type Severity int
+
+const (
+	Info Severity = iota
+	Warning
+	Error
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Warning:
+		return "warning"
+	case Error:
+		return "error"
+	}
+	return "info"
+}
+
+// MarshalText encodes the severity by name.
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes a severity name.
+func (s *Severity) UnmarshalText(b []byte) error {
+	switch string(b) {
+	case "info":
+		*s = Info
+	case "warning":
+		*s = Warning
+	case "error":
+		*s = Error
+	default:
+		return fmt.Errorf("unknown severity %q", b)
+	}
+	return nil
+}
+
+// Check names.
+const (
+	CheckInvalid          = "invalid-rule"
+	CheckDuplicateName    = "duplicate-name"
+	CheckDuplicate        = "duplicate"
+	CheckContradiction    = "contradictory-actions"
+	CheckDifferentDetails = "conflicting-details"
+	CheckShadowed         = "shadowed"
+	CheckBroadBlock       = "broad-block"
+	CheckDisabled         = "disabled"
+	CheckExpired          = "expired-temporary"
+	CheckMissingDuration  = "missing-block-duration"
+)
+
+// Finding is a problem found in a rule.
+type Finding struct {
+	Check    string   `json:"check"`
+	Severity Severity `json:"severity"`
+	RuleID   int      `json:"rule_id"`
+	RuleName string   `json:"rule_name"`
+	Message  string   `json:"message"`
+	Related  []int    `json:"related,omitempty"` // IDs of the other rules involved
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: [%d] %s: %s (%s)", f.Severity, f.RuleID, f.RuleName, f.Message, f.Check)
+}
+
+// Options controls Lint.
+type Options struct {
+	// Now is the reference time for expired temporary rules, time.Now when zero.
+	Now time.Time
+	// MinSeverity drops findings below this severity.
+	MinSeverity Severity
+	// Disable lists checks to skip.
+	Disable []string
+}
+
+// Lint analyzes the rules of a site, given in evaluation order, and returns
+// the findings sorted by decreasing severity.
+func Lint(rules []imperva.Rule, opts Options) []Finding {
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+
+	l := &linter{opts: opts}
+	parsed := make([]*parsedRule, len(rules))
+	for i, r := range rules {
+		parsed[i] = l.parse(r)
+	}
+
+	l.checkNames(parsed)
+	for i, r := range parsed {
+		l.checkRule(r)
+		l.checkPairs(r, parsed[:i])
+	}
+
+	slices.SortStableFunc(l.findings, func(a, b Finding) int { return int(b.Severity - a.Severity) })
+	return l.findings
+}
+
+// WriteJSON writes findings as a JSON array.
+func WriteJSON(w io.Writer, findings []Finding) error {
+	if findings == nil {
+		findings = []Finding{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(findings)
+}
+
+type linter struct {
+	opts     Options
+	findings []Finding
+}
+
+// parsedRule is a rule with its filter parsed, when it parses.
+type parsedRule struct {
+	imperva.Rule
+	node    filter.Node
+	dnf     [][]*filter.Condition // nil when the filter is too large to expand
+	details string                // canonical action details, to compare rules
+}
+
+func (l *linter) report(check string, sev Severity, r imperva.Rule, related []int, format string, args ...interface{}) {
+	if sev < l.opts.MinSeverity || slices.Contains(l.opts.Disable, check) {
+		return
+	}
+	l.findings = append(l.findings, Finding{
+		Check:    check,
+		Severity: sev,
+		RuleID:   r.ID,
+		RuleName: r.Name,
+		Message:  fmt.Sprintf(format, args...),
+		Related:  related,
+	})
+}
+
+func (l *linter) parse(r imperva.Rule) *parsedRule {
+	p := &parsedRule{Rule: r}
+	if err := r.Validate(); err != nil {
+		l.report(CheckInvalid, Error, r, nil, "%v", err)
+	}
+
+	b, _ := json.Marshal(struct {
+		ResponseCode int
+		Block        *imperva.BlockDurationDetails
+		Details      imperva.RuleActionDetails
+	}{r.ResponseCode, r.BlockDurationDetails, r.RuleActionDetails})
+	p.details = string(b)
+
+	if r.Filter == "" {
+		if !slices.Contains(filterlessActions, r.Action) {
+			l.report(CheckInvalid, Warning, r, nil, "empty filter: the rule applies to every request")
+		}
+		return p
+	}
+	n, err := filter.Parse(r.Filter)
+	if err != nil {
+		l.report(CheckInvalid, Error, r, nil, "%v", err)
+		return p
+	}
+	// The parameter tables of the filter package are not exhaustive, so
+	// filters the API may accept are only warned about.
+	if err := filter.Check(n); err != nil {
+		l.report(CheckInvalid, Warning, r, nil, "%v", err)
+	}
+	p.node = n
+	p.dnf = toDNF(n)
+	return p
+}
+
+// filterlessActions are the actions of rules that need no filter.
+var filterlessActions = []string{imperva.RuleActionSimplifiedRedirect}
+
+func (l *linter) checkNames(rules []*parsedRule) {
+	// Rules are grouped by position: rules read from a rule set file have no ID yet.
+	first := map[string]int{}
+	for i, r := range rules {
+		if r.Name == "" {
+			continue
+		}
+		j, ok := first[r.Name]
+		if !ok {
+			first[r.Name] = i
+			continue
+		}
+		ref, related := refer(rules[j].Rule, j)
+		l.report(CheckDuplicateName, Warning, r.Rule, related, "name is also used by %s", ref)
+	}
+}
+
+// refer returns how findings designate r, the rule at index i, and its ID
+// as a related rule when it has one.
+func refer(r imperva.Rule, i int) (string, []int) {
+	if r.ID == 0 {
+		return fmt.Sprintf("rule #%d (%s)", i+1, r.Name), nil
+	}
+	return fmt.Sprintf("rule %d", r.ID), []int{r.ID}
+}
+
+// detailDiffs names the action details that differ between a and b.
+func detailDiffs(a, b imperva.Rule) []string {
+	var fields []string
+	for _, d := range imperva.DiffRules(a, b) {
+		if d.Field != "action" && d.Field != "filter" && d.Field != "enabled" {
+			fields = append(fields, d.Field)
+		}
+	}
+	if len(fields) == 0 {
+		return []string{"action details"}
+	}
+	return fields
+}
+
+// blockingActions are the actions considered blocks by the broad-block and
+// missing-block-duration checks.
+var blockingActions = []string{
+	imperva.RuleActionBlock,
+	imperva.RuleActionBlockIP,
+	imperva.RuleActionBlockUser,
+	imperva.RuleActionBlockSession,
+}
+
+// durationActions are the blocking actions taking a block duration.
+var durationActions = []string{
+	imperva.RuleActionBlockIP,
+	imperva.RuleActionBlockUser,
+	imperva.RuleActionBlockSession,
+}
+
+// terminalActions end rule evaluation, so they can shadow later rules.
+var terminalActions = append([]string{imperva.RuleActionAllow}, blockingActions...)
+
+func (l *linter) checkRule(r *parsedRule) {
+	if !r.IsEnabled() {
+		l.report(CheckDisabled, Info, r.Rule, nil, "rule is disabled; delete it if it is no longer needed")
+	}
+	if at, ok := imperva.RuleExpiry(r.Rule); ok && !at.After(l.opts.Now) {
+		l.report(CheckExpired, Warning, r.Rule, nil, "temporary rule expired on %s", at.Format(time.RFC3339))
+	}
+	if slices.Contains(durationActions, r.Action) && r.BlockDurationDetails == nil {
+		l.report(CheckMissingDuration, Warning, r.Rule, nil, "%s without a block duration", r.Action)
+	}
+	if slices.Contains(blockingActions, r.Action) && r.dnf != nil {
+		if why := broad(r.dnf); why != "" {
+			l.report(CheckBroadBlock, Warning, r.Rule, nil, "overly broad block: %s", why)
+		}
+	}
+}
+
+// checkPairs compares r with the rules evaluated before it.
+func (l *linter) checkPairs(r *parsedRule, earlier []*parsedRule) {
+	if r.node == nil {
+		return
+	}
+	filterText := r.node.String()
+	for i, e := range earlier {
+		if e.node == nil {
+			continue
+		}
+		ref, related := refer(e.Rule, i)
+		if e.node.String() == filterText {
+			switch {
+			case e.Action == r.Action && e.details == r.details:
+				l.report(CheckDuplicate, Warning, r.Rule, related, "same filter and action as %s", ref)
+			case e.Action == r.Action:
+				l.report(CheckDifferentDetails, Warning, r.Rule, related, "same filter and action as %s but different %s", ref, strings.Join(detailDiffs(e.Rule, r.Rule), ", "))
+			default:
+				l.report(CheckContradiction, Error, r.Rule, related, "same filter as %s but action %s instead of %s", ref, r.Action, e.Action)
+			}
+			continue
+		}
+		if e.IsEnabled() && r.IsEnabled() && slices.Contains(terminalActions, e.Action) && subsumes(e.dnf, r.dnf) {
+			l.report(CheckShadowed, Warning, r.Rule, related, "never fires: every request it matches is first handled by %s (%s)", ref, e.Action)
+		}
+	}
+}
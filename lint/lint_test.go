@@ -0,0 +1,125 @@
+package lint
+
+import (
+	"testing"
+
+	"imperva-waf-client"
+)
+
+func checks(findings []Finding) map[string]Severity {
+	out := map[string]Severity{}
+	for _, f := range findings {
+		out[f.Check] = f.Severity
+	}
+	return out
+}
+
+func TestSameFilter(t *testing.T) {
+	block := func(id, minutes int) imperva.Rule {
+		return imperva.Rule{
+			ID:                   id,
+			Name:                 "block",
+			Action:               imperva.RuleActionBlockIP,
+			Filter:               `URL == "/admin"`,
+			BlockDurationDetails: &imperva.BlockDurationDetails{BlockDurationPeriodType: "fixed", BlockFixedDurationValue: minutes},
+		}
+	}
+	opts := Options{Disable: []string{CheckDuplicateName}}
+
+	got := checks(Lint([]imperva.Rule{block(1, 10), block(2, 10)}, opts))
+	if got[CheckDuplicate] != Warning || len(got) != 1 {
+		t.Errorf("identical rules: %v, want a duplicate warning only", got)
+	}
+
+	got = checks(Lint([]imperva.Rule{block(1, 10), block(2, 60)}, opts))
+	if got[CheckDifferentDetails] != Warning || len(got) != 1 {
+		t.Errorf("different block durations: %v, want a conflicting-details warning only", got)
+	}
+
+	alert := block(2, 10)
+	alert.Action, alert.BlockDurationDetails = imperva.RuleActionAlert, nil
+	got = checks(Lint([]imperva.Rule{block(1, 10), alert}, opts))
+	if got[CheckContradiction] != Error {
+		t.Errorf("different actions: %v, want a contradictory-actions error", got)
+	}
+}
+
+func TestShadowed(t *testing.T) {
+	rules := []imperva.Rule{
+		{ID: 1, Name: "allow office", Action: imperva.RuleActionAllow, Filter: `ClientIP == 10.0.0.0/16`},
+		{ID: 2, Name: "block host", Action: imperva.RuleActionBlock, Filter: `ClientIP == 10.0.1.5 & URL == "/admin"`},
+		{ID: 3, Name: "block other", Action: imperva.RuleActionBlock, Filter: `ClientIP == 192.168.0.1`},
+	}
+	for _, f := range Lint(rules, Options{}) {
+		if f.Check != CheckShadowed {
+			continue
+		}
+		if f.RuleID != 2 || len(f.Related) != 1 || f.Related[0] != 1 {
+			t.Errorf("shadowed finding = %+v, want rule 2 shadowed by rule 1", f)
+		}
+		return
+	}
+	t.Error("no shadowed finding for rule 2")
+}
+
+func TestDuplicateNamesWithoutIDs(t *testing.T) {
+	rules := []imperva.Rule{
+		{Name: "a", Action: imperva.RuleActionAlert, Filter: `URL == "/a"`},
+		{Name: "a", Action: imperva.RuleActionAlert, Filter: `URL == "/b"`},
+		{Name: "b", Action: imperva.RuleActionAlert, Filter: `URL == "/c"`},
+	}
+	var dups []Finding
+	for _, f := range Lint(rules, Options{}) {
+		if f.Check == CheckDuplicateName {
+			dups = append(dups, f)
+		}
+	}
+	if len(dups) != 1 || dups[0].Message != "name is also used by rule #1 (a)" {
+		t.Errorf("duplicate-name findings = %+v, want one for the second rule", dups)
+	}
+}
+
+func TestInvalidFilterSeverity(t *testing.T) {
+	tests := []struct {
+		name   string
+		rule   imperva.Rule
+		want   Severity
+		report bool
+	}{
+		{
+			name:   "syntax error",
+			rule:   imperva.Rule{Name: "r", Action: imperva.RuleActionAlert, Filter: `URL == "/a" &`},
+			want:   Error,
+			report: true,
+		},
+		{
+			name:   "unknown parameter",
+			rule:   imperva.Rule{Name: "r", Action: imperva.RuleActionAlert, Filter: `ClientType == "Bad Bot"`},
+			want:   Warning,
+			report: true,
+		},
+		{
+			name:   "empty filter",
+			rule:   imperva.Rule{Name: "r", Action: imperva.RuleActionAlert},
+			want:   Warning,
+			report: true,
+		},
+		{
+			name: "simplified redirect without a filter",
+			rule: imperva.Rule{
+				Name:              "r",
+				Action:            imperva.RuleActionSimplifiedRedirect,
+				ResponseCode:      301,
+				RuleActionDetails: imperva.RuleActionDetails{From: "/a", To: "/b"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sev, ok := checks(Lint([]imperva.Rule{tt.rule}, Options{}))[CheckInvalid]
+			if ok != tt.report || ok && sev != tt.want {
+				t.Errorf("invalid-rule finding = %v (reported %t), want %v (reported %t)", sev, ok, tt.want, tt.report)
+			}
+		})
+	}
+}
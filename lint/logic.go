@@ -0,0 +1,168 @@
+package lint
+
+import (
+	"net/netip"
+	"slices"
+	"strings"
+
+	"imperva-waf-client/filter"
+)
+
+// maxConjuncts bounds the size of the disjunctive normal form of a filter.
+const maxConjuncts = 64
+
+// toDNF expands a filter into a disjunction of conjunctions of conditions.
+// It returns nil when the expansion would exceed maxConjuncts.
+func toDNF(n filter.Node) [][]*filter.Condition {
+	switch n := n.(type) {
+	case *filter.Condition:
+		return [][]*filter.Condition{{n}}
+	case *filter.ParenExpr:
+		return toDNF(n.X)
+	case *filter.BinaryExpr:
+		x, y := toDNF(n.X), toDNF(n.Y)
+		if x == nil || y == nil {
+			return nil
+		}
+		if n.Op == filter.Or {
+			if len(x)+len(y) > maxConjuncts {
+				return nil
+			}
+			return append(slices.Clone(x), y...)
+		}
+		if len(x)*len(y) > maxConjuncts {
+			return nil
+		}
+		var out [][]*filter.Condition
+		for _, a := range x {
+			for _, b := range y {
+				out = append(out, append(slices.Clone(a), b...))
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// subsumes reports whether every request matched by b is matched by a,
+// as far as can be told syntactically: each conjunction of b must be
+// implied by some conjunction of a.
+func subsumes(a, b [][]*filter.Condition) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	for _, cb := range b {
+		if !slices.ContainsFunc(a, func(ca []*filter.Condition) bool { return implies(cb, ca) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// implies reports whether conjunction x implies conjunction y, i.e. every
+// condition of y is covered by a condition of x.
+func implies(x, y []*filter.Condition) bool {
+	for _, cy := range y {
+		if !slices.ContainsFunc(x, func(cx *filter.Condition) bool { return covers(cy, cx) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// covers reports whether condition x implies condition y.
+func covers(y, x *filter.Condition) bool {
+	if x.Param.String() != y.Param.String() || x.Op != y.Op {
+		return false
+	}
+	spec, _ := filter.LookupParam(x.Param.Name)
+	// For positive operators x implies y when x accepts fewer values; for
+	// negated ones when x excludes more values.
+	narrow, wide := x.Values, y.Values
+	if x.Op.Negated() {
+		narrow, wide = y.Values, x.Values
+	}
+	for _, v := range narrow {
+		if !slices.ContainsFunc(wide, func(w filter.Value) bool { return valueWithin(spec, v.Text, w.Text) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// valueWithin reports whether matching v implies matching w.
+func valueWithin(spec filter.ParamSpec, v, w string) bool {
+	if v == w {
+		return true
+	}
+	if spec.Kind != filter.KindIP {
+		return false
+	}
+	pw, err := netip.ParsePrefix(w)
+	if err != nil {
+		return false
+	}
+	if a, err := netip.ParseAddr(v); err == nil {
+		return pw.Contains(a)
+	}
+	if pv, err := netip.ParsePrefix(v); err == nil {
+		return pv.Bits() >= pw.Bits() && pw.Contains(pv.Addr())
+	}
+	return false
+}
+
+// broad explains why a blocking filter matches too much traffic, or returns "".
+func broad(dnf [][]*filter.Condition) string {
+	for _, conj := range dnf {
+		countriesOnly := true
+		for _, c := range conj {
+			if why := broadCondition(c); why != "" {
+				return why
+			}
+			spec, _ := filter.LookupParam(c.Param.Name)
+			if spec.Name != filter.ParamCountryCode || c.Op != filter.Equal {
+				countriesOnly = false
+			}
+		}
+		if countriesOnly {
+			return "blocks whole countries without any other condition"
+		}
+	}
+	return ""
+}
+
+func broadCondition(c *filter.Condition) string {
+	spec, _ := filter.LookupParam(c.Param.Name)
+	for _, v := range c.Values {
+		switch {
+		case spec.Name == filter.ParamURL && c.Op == filter.Contains && (v.Text == "/" || v.Text == ""):
+			return `URL contains "/" matches every request`
+		case (c.Op == filter.Matches) && (v.Text == ".*" || v.Text == "" || v.Text == "^"):
+			return c.Param.String() + " ~ " + filter.Quote(v.Text) + " matches every request"
+		case spec.Kind == filter.KindIP && c.Op == filter.Equal:
+			if p, err := netip.ParsePrefix(v.Text); err == nil && p.Bits() <= maxBroadBits(p.Addr()) {
+				return "IP block " + v.Text + " is very large"
+			}
+		}
+	}
+	if spec.Name == filter.ParamCountryCode && c.Op == filter.NotEqual {
+		return "blocks every country but " + strings.Join(valueTexts(c), ", ")
+	}
+	return ""
+}
+
+// maxBroadBits is the prefix length at or below which an IP block is considered broad.
+func maxBroadBits(a netip.Addr) int {
+	if a.Is4() {
+		return 8
+	}
+	return 32
+}
+
+func valueTexts(c *filter.Condition) []string {
+	out := make([]string, len(c.Values))
+	for i, v := range c.Values {
+		out[i] = v.Text
+	}
+	return out
+}
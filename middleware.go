@@ -0,0 +1,141 @@
+package imperva
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Doer sends an HTTP request and returns its response. *http.Client implements it.
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// DoerFunc adapts a function to the Doer interface.
+type DoerFunc func(req *http.Request) (*http.Response, error)
+
+// Do calls f(req).
+func (f DoerFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Middleware wraps a Doer to add behavior around each HTTP attempt.
+//
+// Middlewares run inside Client.Do, after the authentication headers are set
+// and the rate limiter has been waited on. Retries are driven above Client.Do,
+// so a middleware sees every attempt of a retried call as a separate request.
+type Middleware func(next Doer) Doer
+
+// chain wraps d with middlewares, the first one being the outermost.
+func chain(d Doer, middlewares []Middleware) Doer {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		d = middlewares[i](d)
+	}
+	return d
+}
+
+// sensitiveParams lists headers and query parameters carrying credentials.
+var sensitiveParams = []string{"x-API-Key", "api_key"}
+
+const redacted = "REDACTED"
+
+func isSensitive(name string) bool {
+	for _, p := range sensitiveParams {
+		if strings.EqualFold(p, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactURL returns u as a string with credential query parameters masked.
+func redactURL(u *url.URL) string {
+	q := u.Query()
+	changed := false
+	for k := range q {
+		if isSensitive(k) {
+			q.Set(k, redacted)
+			changed = true
+		}
+	}
+	if !changed {
+		return u.String()
+	}
+	cp := *u
+	cp.RawQuery = q.Encode()
+	return cp.String()
+}
+
+// redactHeaders returns a copy of h with credential headers masked.
+func redactHeaders(h http.Header) http.Header {
+	cp := h.Clone()
+	for k := range cp {
+		if isSensitive(k) {
+			cp[k] = []string{redacted}
+		}
+	}
+	return cp
+}
+
+// LoggingMiddleware logs every request with logger, masking the API key.
+// Outcomes are logged at Info level (Warn for failures) and request headers
+// at Debug level.
+func LoggingMiddleware(logger *slog.Logger) Middleware {
+	return func(next Doer) Doer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			ctx := req.Context()
+			target := redactURL(req.URL)
+			logger.DebugContext(ctx, "imperva request",
+				slog.String("method", req.Method),
+				slog.String("url", target),
+				slog.Any("headers", redactHeaders(req.Header)),
+			)
+
+			start := time.Now()
+			resp, err := next.Do(req)
+			attrs := []any{
+				slog.String("method", req.Method),
+				slog.String("url", target),
+				slog.Duration("duration", time.Since(start)),
+			}
+			switch {
+			case err != nil:
+				logger.WarnContext(ctx, "imperva request failed", append(attrs, slog.Any("error", err))...)
+			case resp.StatusCode >= 400:
+				logger.WarnContext(ctx, "imperva request failed", append(attrs, slog.Int("status", resp.StatusCode))...)
+			default:
+				logger.InfoContext(ctx, "imperva request", append(attrs, slog.Int("status", resp.StatusCode))...)
+			}
+			return resp, err
+		})
+	}
+}
+
+// TimingMiddleware reports the duration of every request to observe, e.g. to
+// feed a metrics histogram. resp is nil when err is not.
+func TimingMiddleware(observe func(req *http.Request, resp *http.Response, err error, d time.Duration)) Middleware {
+	return func(next Doer) Doer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.Do(req)
+			observe(req, resp, err, time.Since(start))
+			return resp, err
+		})
+	}
+}
+
+// HeaderMiddleware adds the given headers to every request.
+func HeaderMiddleware(headers http.Header) Middleware {
+	return func(next Doer) Doer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			for k, vs := range headers {
+				for _, v := range vs {
+					req.Header.Add(k, v)
+				}
+			}
+			return next.Do(req)
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package imperva
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"imperva-waf-client/filter"
+)
+
+// RateContext is what a rate rule counts requests per.
+type RateContext string
+
+// RateContext constants
+const (
+	RateContextIP      RateContext = "IP"
+	RateContextSession RateContext = "Session"
+	RateContextURL     RateContext = "URL"
+)
+
+// RateContexts lists the known rate contexts.
+var RateContexts = []RateContext{RateContextIP, RateContextSession, RateContextURL}
+
+// Valid reports whether c is one of RateContexts.
+func (c RateContext) Valid() bool {
+	return slices.Contains(RateContexts, c)
+}
+
+// RateInterval is the window, in seconds, over which a rate rule counts requests.
+type RateInterval int
+
+// RateInterval constants
+const (
+	RateInterval10s RateInterval = 10
+	RateInterval20s RateInterval = 20
+	RateInterval30s RateInterval = 30
+	RateInterval1m  RateInterval = 60
+	RateInterval2m  RateInterval = 120
+	RateInterval5m  RateInterval = 300
+)
+
+// RateIntervals lists the intervals accepted by the API.
+var RateIntervals = []RateInterval{
+	RateInterval10s,
+	RateInterval20s,
+	RateInterval30s,
+	RateInterval1m,
+	RateInterval2m,
+	RateInterval5m,
+}
+
+// Valid reports whether i is one of RateIntervals.
+func (i RateInterval) Valid() bool {
+	return slices.Contains(RateIntervals, i)
+}
+
+// UnmarshalJSON accepts the interval as a number or, as some endpoints send
+// it, as a string.
+func (i *RateInterval) UnmarshalJSON(b []byte) error {
+	var n int
+	if err := json.Unmarshal(b, &n); err == nil {
+		*i = RateInterval(n)
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("invalid rate_interval %s", b)
+	}
+	if s == "" {
+		*i = 0
+		return nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("invalid rate_interval %q", s)
+	}
+	*i = RateInterval(n)
+	return nil
+}
+
+// validateRate checks the rate fields of a RULE_ACTION_RATE rule.
+func (r Rule) validateRate() []error {
+	var errs []error
+	if r.RateContext != "" && !r.RateContext.Valid() {
+		errs = append(errs, fmt.Errorf("unknown rate_context %q", r.RateContext))
+	}
+	if r.RateInterval != 0 && !r.RateInterval.Valid() {
+		errs = append(errs, fmt.Errorf("unsupported rate_interval %d", r.RateInterval))
+	}
+	return errs
+}
+
+// NewRateRule returns a rule counting the requests matching filter per
+// rateContext over interval.
+func NewRateRule(name, filter string, rateContext RateContext, interval RateInterval) Rule {
+	return Rule{
+		Name:              name,
+		Action:            RuleActionRate,
+		Filter:            filter,
+		RuleActionDetails: RuleActionDetails{RateContext: rateContext, RateInterval: interval},
+	}
+}
+
+// NewLoginBruteForceRule returns a rate rule counting the POST requests to
+// loginPath per rateContext over interval, the usual building block of login
+// brute-force protection.
+func NewLoginBruteForceRule(name, loginPath string, rateContext RateContext, interval RateInterval) Rule {
+	f := filter.URL().Eq(loginPath).And(filter.Method().Eq("POST"))
+	return NewRateRule(name, f.String(), rateContext, interval)
+}
+
+// ListRateRules lists the rate rules of a site.
+func (c *Client) ListRateRules(siteID int) ([]Rule, error) {
+	return c.ListRateRulesContext(context.Background(), siteID)
+}
+
+// ListRateRulesContext is like ListRateRules but carries ctx for cancellation and deadlines.
+func (c *Client) ListRateRulesContext(ctx context.Context, siteID int) ([]Rule, error) {
+	var rules []Rule
+	for rule, err := range c.IterRules(ctx, siteID) {
+		if err != nil {
+			return nil, err
+		}
+		if rule.Action == RuleActionRate {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
@@ -0,0 +1,95 @@
+package imperva
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket limiting the rate of API requests.
+// It is safe for concurrent use and can be shared between several clients.
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a limiter allowing rps requests per second on
+// average, with bursts of up to burst requests. A burst below 1 is treated as 1.
+func NewRateLimiter(rps float64, burst int) *RateLimiter {
+	b := float64(max(burst, 1))
+	return &RateLimiter{
+		rate:   rps,
+		burst:  b,
+		tokens: b,
+		last:   time.Now(),
+	}
+}
+
+// limiterKey identifies a shared limiter: clients share one only when both
+// their API ID and their settings match.
+type limiterKey struct {
+	apiID string
+	rps   float64
+	burst int
+}
+
+var (
+	sharedLimitersMu sync.Mutex
+	sharedLimiters   = map[limiterKey]*RateLimiter{}
+)
+
+// SharedRateLimiter returns the limiter registered for apiID with rps and
+// burst, creating it on first use. Clients built with the same API ID and
+// settings then draw from a single quota, matching how Imperva enforces it.
+// Different settings get a separate limiter, so clients sharing an API ID
+// must agree on them to share the quota. An empty apiID identifies no
+// account and always gets a new limiter.
+func SharedRateLimiter(apiID string, rps float64, burst int) *RateLimiter {
+	if apiID == "" {
+		return NewRateLimiter(rps, burst)
+	}
+	k := limiterKey{apiID, rps, max(burst, 1)}
+
+	sharedLimitersMu.Lock()
+	defer sharedLimitersMu.Unlock()
+
+	if l, ok := sharedLimiters[k]; ok {
+		return l
+	}
+	l := NewRateLimiter(rps, burst)
+	sharedLimiters[k] = l
+	return l
+}
+
+// Wait blocks until a request may be sent or ctx is done.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if l == nil || l.rate <= 0 {
+		return ctx.Err()
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+
+	// Reserve a token now, even if it makes the bucket negative, so waiters
+	// are served in order.
+	l.tokens--
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if err := sleepContext(ctx, wait); err != nil {
+		// Give the reservation back so a cancelled caller does not slow down others.
+		l.mu.Lock()
+		l.tokens = min(l.burst, l.tokens+1)
+		l.mu.Unlock()
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package imperva_test
+
+import (
+	"testing"
+
+	"imperva-waf-client"
+)
+
+func TestSharedRateLimiter(t *testing.T) {
+	l := imperva.SharedRateLimiter("shared-id", 10, 5)
+	tests := []struct {
+		name   string
+		apiID  string
+		rps    float64
+		burst  int
+		shared bool
+	}{
+		{"same settings", "shared-id", 10, 5, true},
+		{"other API ID", "other-id", 10, 5, false},
+		{"other rate", "shared-id", 20, 5, false},
+		{"other burst", "shared-id", 10, 1, false},
+		{"empty API ID", "", 10, 5, false},
+	}
+	for _, tt := range tests {
+		got := imperva.SharedRateLimiter(tt.apiID, tt.rps, tt.burst)
+		if (got == l) != tt.shared {
+			t.Errorf("%s: shared = %t, want %t", tt.name, got == l, tt.shared)
+		}
+	}
+
+	if imperva.SharedRateLimiter("", 10, 5) == imperva.SharedRateLimiter("", 10, 5) {
+		t.Error("clients without an API ID share a limiter")
+	}
+	if imperva.SharedRateLimiter("burst-id", 10, 0) != imperva.SharedRateLimiter("burst-id", 10, 1) {
+		t.Error("bursts 0 and 1, which are equivalent, got different limiters")
+	}
+
+	a := imperva.NewClient(&imperva.Config{APIID: "client-id", RequestsPerSecond: 10})
+	b := imperva.NewClient(&imperva.Config{APIID: "client-id", RequestsPerSecond: 10})
+	if a.Limiter == nil || a.Limiter != b.Limiter {
+		t.Error("clients with the same API ID and settings do not share a limiter")
+	}
+}
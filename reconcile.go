@@ -0,0 +1,354 @@
+package imperva
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"imperva-waf-client/filter"
+)
+
+// ChangeAction is the kind of a planned rule change.
+type ChangeAction string
+
+const (
+	ChangeCreate ChangeAction = "create"
+	ChangeUpdate ChangeAction = "update"
+	ChangeDelete ChangeAction = "delete"
+)
+
+// FieldDiff is a field whose value differs between two rules.
+type FieldDiff struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// RuleChange is a change needed to bring a site rule to its desired state.
+type RuleChange struct {
+	Action  ChangeAction
+	Name    string
+	Current *Rule // nil for creations
+	Desired *Rule // nil for deletions
+	Diffs   []FieldDiff
+}
+
+// Plan lists the changes needed to reconcile the rules of a site.
+type Plan struct {
+	SiteID    int
+	Changes   []RuleChange
+	Unchanged []string // names of rules already in their desired state
+}
+
+// Empty reports whether the plan has no change.
+func (p *Plan) Empty() bool {
+	return len(p.Changes) == 0
+}
+
+// String returns a human-readable description of the plan.
+func (p *Plan) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Site %d: %d to create, %d to update, %d to delete, %d unchanged\n",
+		p.SiteID, p.count(ChangeCreate), p.count(ChangeUpdate), p.count(ChangeDelete), len(p.Unchanged))
+	for _, ch := range p.Changes {
+		switch ch.Action {
+		case ChangeCreate:
+			fmt.Fprintf(&b, "  + %s\n", ch.Name)
+		case ChangeUpdate:
+			fmt.Fprintf(&b, "  ~ %s (id %d)\n", ch.Name, ch.Current.ID)
+		case ChangeDelete:
+			fmt.Fprintf(&b, "  - %s (id %d)\n", ch.Name, ch.Current.ID)
+		}
+		for _, d := range ch.Diffs {
+			fmt.Fprintf(&b, "      %s: %q -> %q\n", d.Field, d.Old, d.New)
+		}
+	}
+	return b.String()
+}
+
+func (p *Plan) count(a ChangeAction) int {
+	n := 0
+	for _, ch := range p.Changes {
+		if ch.Action == a {
+			n++
+		}
+	}
+	return n
+}
+
+// PlanOptions controls how a plan is computed.
+type PlanOptions struct {
+	// Prune deletes rules that exist on the site but are not desired.
+	Prune bool
+	// MatchByID matches desired rules carrying an ID with the current rule
+	// of that ID, so renamed rules are updated rather than recreated and
+	// duplicate names are allowed. Desired rules whose ID no longer exists
+	// fall back to matching by name. Use it for rules read back from the
+	// same site, such as snapshots.
+	MatchByID bool
+}
+
+// ComputePlan compares the current rules of a site with the desired ones,
+// matching them by name, or by ID first with opts.MatchByID. Desired rules
+// must have non-empty names, unique unless opts.MatchByID is set. When
+// several current rules share a name, the one with the lowest ID is
+// reconciled and the others are deleted if opts.Prune is set.
+func ComputePlan(siteID int, current, desired []Rule, opts PlanOptions) (*Plan, error) {
+	seen := map[string]bool{}
+	targeted := map[int]bool{} // current rule IDs claimed by ID
+	for _, r := range desired {
+		if r.Name == "" {
+			return nil, fmt.Errorf("desired rule without a name (filter %q)", r.Filter)
+		}
+		if seen[r.Name] && !opts.MatchByID {
+			return nil, fmt.Errorf("duplicate desired rule name %q", r.Name)
+		}
+		seen[r.Name] = true
+		if opts.MatchByID && r.ID != 0 {
+			targeted[r.ID] = true
+		}
+	}
+
+	current = slices.Clone(current)
+	slices.SortStableFunc(current, func(a, b Rule) int { return a.ID - b.ID })
+	claimed := map[int]bool{}
+
+	// match returns the current rule reconciled with want, if any.
+	match := func(want Rule) (Rule, bool) {
+		if opts.MatchByID && want.ID != 0 {
+			for _, r := range current {
+				if r.ID == want.ID && !claimed[r.ID] {
+					return r, true
+				}
+			}
+		}
+		for _, r := range current {
+			if r.Name == want.Name && !claimed[r.ID] && !targeted[r.ID] {
+				return r, true
+			}
+		}
+		return Rule{}, false
+	}
+
+	plan := &Plan{SiteID: siteID}
+	for _, want := range desired {
+		want := want
+		have, ok := match(want)
+		if !ok {
+			plan.Changes = append(plan.Changes, RuleChange{
+				Action:  ChangeCreate,
+				Name:    want.Name,
+				Desired: &want,
+				Diffs:   DiffRules(Rule{}, want),
+			})
+			continue
+		}
+		claimed[have.ID] = true
+
+		diffs := DiffRules(have, want)
+		if have.Name != want.Name {
+			diffs = append([]FieldDiff{{Field: "name", Old: have.Name, New: want.Name}}, diffs...)
+		}
+		if len(diffs) == 0 {
+			plan.Unchanged = append(plan.Unchanged, want.Name)
+			continue
+		}
+		plan.Changes = append(plan.Changes, RuleChange{
+			Action:  ChangeUpdate,
+			Name:    want.Name,
+			Current: &have,
+			Desired: &want,
+			Diffs:   diffs,
+		})
+	}
+
+	if opts.Prune {
+		for _, have := range current {
+			have := have
+			if claimed[have.ID] {
+				continue
+			}
+			plan.Changes = append(plan.Changes, RuleChange{
+				Action:  ChangeDelete,
+				Name:    have.Name,
+				Current: &have,
+			})
+		}
+	}
+	return plan, nil
+}
+
+// ruleFields returns the comparable fields of a rule, in display order.
+func ruleFields(r Rule) [][2]string {
+	block := ""
+	if d := r.BlockDurationDetails; d != nil {
+		block = d.BlockDurationPeriodType + ":" + strconv.Itoa(d.BlockFixedDurationValue)
+	}
+	d := r.RuleActionDetails
+	return [][2]string{
+		{"action", r.Action},
+		{"filter", canonicalFilter(r.Filter)},
+		{"response_code", intField(r.ResponseCode)},
+		{"enabled", strconv.FormatBool(r.IsEnabled())},
+		{"block_duration", block},
+		{"from", d.From},
+		{"to", d.To},
+		{"rewrite_existing", boolField(d.RewriteExisting)},
+		{"add_missing", boolField(d.AddMissing)},
+		{"rewrite_name", d.RewriteName},
+		{"multiple_deletions", boolField(d.MultipleDeletions)},
+		{"dc_id", intField(d.DCID)},
+		{"port_forwarding_context", d.PortForwardingContext},
+		{"port_forwarding_value", d.PortForwardingValue},
+		{"rate_context", string(d.RateContext)},
+		{"rate_interval", intField(int(d.RateInterval))},
+		{"error_type", d.ErrorType},
+		{"error_response_format", d.ErrorResponseFormat},
+		{"error_response_data", d.ErrorResponseData},
+	}
+}
+
+func boolField(b *bool) string {
+	if b == nil || !*b {
+		return ""
+	}
+	return "true"
+}
+
+func intField(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+// canonicalFilter formats f canonically so formatting differences are not
+// reported as changes. Filters that do not parse are compared verbatim.
+func canonicalFilter(f string) string {
+	if c, err := filter.Format(f); err == nil {
+		return c
+	}
+	return strings.TrimSpace(f)
+}
+
+// DiffRules returns the fields that differ between rules a and b, ignoring IDs and names.
+func DiffRules(a, b Rule) []FieldDiff {
+	var diffs []FieldDiff
+	fa, fb := ruleFields(a), ruleFields(b)
+	for i := range fa {
+		if fa[i][1] != fb[i][1] {
+			diffs = append(diffs, FieldDiff{Field: fa[i][0], Old: fa[i][1], New: fb[i][1]})
+		}
+	}
+	return diffs
+}
+
+// PlanRules computes the plan reconciling the rules of a site with desired.
+func (c *Client) PlanRules(siteID int, desired []Rule, opts PlanOptions) (*Plan, error) {
+	return c.PlanRulesContext(context.Background(), siteID, desired, opts)
+}
+
+// PlanRulesContext is like PlanRules but carries ctx for cancellation and deadlines.
+func (c *Client) PlanRulesContext(ctx context.Context, siteID int, desired []Rule, opts PlanOptions) (*Plan, error) {
+	current, err := c.ListRulesContext(ctx, siteID)
+	if err != nil {
+		return nil, err
+	}
+	return ComputePlan(siteID, current, desired, opts)
+}
+
+// ApplyOptions controls how a plan is applied.
+type ApplyOptions struct {
+	// ContinueOnError applies the remaining changes after a failure instead
+	// of stopping at the first one.
+	ContinueOnError bool
+}
+
+// ApplyResult is the outcome of one planned change.
+type ApplyResult struct {
+	Change  RuleChange
+	Rule    *Rule // rule returned by the API for creations and updates
+	Err     error
+	Skipped bool // not attempted because an earlier change failed
+}
+
+// checkConverged reports the fields of want that the rule returned by the
+// API does not carry. Responses that do not echo the rule are not checked.
+func checkConverged(got *Rule, want Rule) error {
+	if got == nil || got.Name == "" {
+		return nil
+	}
+	diffs := DiffRules(*got, want)
+	if len(diffs) == 0 {
+		return nil
+	}
+	fields := make([]string, len(diffs))
+	for i, d := range diffs {
+		fields[i] = d.Field
+	}
+	return fmt.Errorf("rule not in its desired state after update: %s differ", strings.Join(fields, ", "))
+}
+
+// ApplyPlan applies the changes of plan in order and returns one result per
+// change. The returned error is the first failure, if any. A change applied
+// but not recorded in the journal keeps its rule, has a *JournalError and
+// does not stop the plan.
+func (c *Client) ApplyPlan(plan *Plan, opts ApplyOptions) ([]ApplyResult, error) {
+	return c.ApplyPlanContext(context.Background(), plan, opts)
+}
+
+// ApplyPlanContext is like ApplyPlan but carries ctx for cancellation and deadlines.
+func (c *Client) ApplyPlanContext(ctx context.Context, plan *Plan, opts ApplyOptions) ([]ApplyResult, error) {
+	results := make([]ApplyResult, 0, len(plan.Changes))
+	var firstErr error
+	failed := false
+	for _, ch := range plan.Changes {
+		res := ApplyResult{Change: ch}
+		diverged := false
+		if failed && !opts.ContinueOnError {
+			res.Skipped = true
+			results = append(results, res)
+			continue
+		}
+
+		switch ch.Action {
+		case ChangeCreate:
+			// Desired rules may come from another site or a snapshot: never send their ID.
+			want := *ch.Desired
+			want.ID = 0
+			want.Enabled = Bool(want.IsEnabled())
+			res.Rule, res.Err = c.CreateRuleContext(ctx, plan.SiteID, want)
+		case ChangeUpdate:
+			// Overwrite rather than update: a partial update cannot clear fields.
+			// Enabled is always sent, as omitting it would not re-enable a
+			// disabled rule.
+			want := *ch.Desired
+			want.ID = ch.Current.ID
+			want.Enabled = Bool(want.IsEnabled())
+			res.Rule, res.Err = c.OverwriteRuleContext(ctx, plan.SiteID, ch.Current.ID, want)
+			// A journal failure does not mean the overwrite failed: check it too.
+			if res.Err == nil || isJournalError(res.Err) {
+				if err := checkConverged(res.Rule, want); err != nil {
+					res.Err = errors.Join(err, res.Err)
+					diverged = true
+				}
+			}
+		case ChangeDelete:
+			res.Err = c.DeleteRuleContext(ctx, plan.SiteID, ch.Current.ID)
+		default:
+			res.Err = fmt.Errorf("unknown change action %q", ch.Action)
+		}
+		if res.Err != nil {
+			res.Err = fmt.Errorf("%s rule %q: %w", ch.Action, ch.Name, res.Err)
+			if firstErr == nil {
+				firstErr = res.Err
+			}
+			failed = failed || diverged || !isJournalError(res.Err)
+		}
+		results = append(results, res)
+	}
+	return results, firstErr
+}
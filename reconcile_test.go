@@ -0,0 +1,87 @@
+package imperva_test
+
+import (
+	"strings"
+	"testing"
+
+	"imperva-waf-client"
+	"imperva-waf-client/impervatest"
+)
+
+func TestApplyPlanClearsFields(t *testing.T) {
+	srv := impervatest.NewServer()
+	defer srv.Close()
+	srv.AddSite(imperva.Site{SiteID: 1, Domain: "example.com"})
+	srv.AddRule(1, imperva.Rule{
+		Name:                 "block",
+		Action:               imperva.RuleActionBlockIP,
+		Filter:               `URL == "/admin"`,
+		ResponseCode:         403,
+		BlockDurationDetails: &imperva.BlockDurationDetails{BlockDurationPeriodType: "fixed", BlockFixedDurationValue: 10},
+	})
+	client := srv.Client()
+
+	desired := []imperva.Rule{{Name: "block", Action: imperva.RuleActionBlock, Filter: `URL == "/admin"`}}
+	plan, err := client.PlanRules(1, desired, imperva.PlanOptions{})
+	if err != nil {
+		t.Fatalf("PlanRules: %v", err)
+	}
+	if len(plan.Changes) != 1 {
+		t.Fatalf("plan = %s, want one update", plan)
+	}
+	if _, err := client.ApplyPlan(plan, imperva.ApplyOptions{}); err != nil {
+		t.Fatalf("ApplyPlan: %v", err)
+	}
+
+	plan, err = client.PlanRules(1, desired, imperva.PlanOptions{})
+	if err != nil {
+		t.Fatalf("PlanRules after apply: %v", err)
+	}
+	if !plan.Empty() {
+		t.Errorf("plan after apply = %s, want no change", plan)
+	}
+	got := srv.Rules(1)[0]
+	if got.ResponseCode != 0 || got.BlockDurationDetails != nil {
+		t.Errorf("rule after apply = %+v, want response code and block duration cleared", got)
+	}
+}
+
+func TestApplyPlanReenablesRule(t *testing.T) {
+	srv := impervatest.NewServer()
+	defer srv.Close()
+	srv.AddSite(imperva.Site{SiteID: 1, Domain: "example.com"})
+	client := srv.Client()
+
+	desired := []imperva.Rule{{Name: "block", Action: imperva.RuleActionBlock, Filter: `URL == "/admin"`}}
+	created, err := client.CreateRule(1, desired[0])
+	if err != nil {
+		t.Fatalf("CreateRule: %v", err)
+	}
+	if _, err := client.DisableRule(1, created.ID); err != nil {
+		t.Fatalf("DisableRule: %v", err)
+	}
+
+	plan, err := client.PlanRules(1, desired, imperva.PlanOptions{})
+	if err != nil {
+		t.Fatalf("PlanRules: %v", err)
+	}
+	if len(plan.Changes) != 1 {
+		t.Fatalf("plan = %s, want one update", plan)
+	}
+	if _, err := client.ApplyPlan(plan, imperva.ApplyOptions{}); err != nil {
+		t.Fatalf("ApplyPlan: %v", err)
+	}
+
+	// The overwrite must say so explicitly rather than rely on a default.
+	reqs := srv.Requests()
+	if body := string(reqs[len(reqs)-1].Body); !strings.Contains(body, `"enabled":true`) {
+		t.Errorf("overwrite body = %s, want enabled set", body)
+	}
+	plan, err = client.PlanRules(1, desired, imperva.PlanOptions{})
+	if err != nil {
+		t.Fatalf("PlanRules after apply: %v", err)
+	}
+	if !plan.Empty() {
+		t.Errorf("plan after apply = %s, want no change", plan)
+	}
+}
@@ -0,0 +1,75 @@
+// Package replay provides HTTP transports to record Imperva API traffic to a
+// JSONL file and to serve it back deterministically, so code using the client
+// can be exercised without network access.
+//
+// Recording a session:
+//
+//	f, _ := os.Create("testdata/sites.jsonl")
+//	defer f.Close()
+//	client := imperva.NewClient(config)
+//	client.HTTPClient.Transport = replay.NewRecorder(f, nil)
+//
+// Replaying it later:
+//
+//	r, _ := replay.Load("testdata/sites.jsonl")
+//	client := imperva.NewClient(&imperva.Config{Host: "https://my.imperva.com"})
+//	client.HTTPClient.Transport = r
+package replay
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Interaction is a recorded request/response pair, one per JSONL line.
+// Credentials are never stored: request headers are not recorded, credential
+// headers are removed from the response headers and credential query
+// parameters are stripped from the URL.
+type Interaction struct {
+	Method      string              `json:"method"`
+	URL         string              `json:"url"` // path and normalized query, without scheme and host
+	RequestBody string              `json:"request_body,omitempty"`
+	Status      int                 `json:"status"`
+	Header      map[string][]string `json:"header,omitempty"` // response headers
+	Body        string              `json:"body"`
+}
+
+// credentialParams are query parameters removed before recording or matching.
+var credentialParams = []string{"api_id", "api_key"}
+
+// credentialHeaders are response headers removed before recording, in case
+// a proxy or the API echoes the credentials back.
+var credentialHeaders = []string{"x-API-Id", "x-API-Key", "Authorization"}
+
+// redactHeader returns a copy of h without credential headers.
+func redactHeader(h http.Header) http.Header {
+	h = h.Clone()
+	for _, name := range credentialHeaders {
+		h.Del(name)
+	}
+	return h
+}
+
+// normalizeURL returns the path and the sorted query of u, without credentials.
+func normalizeURL(u *url.URL) string {
+	q := u.Query()
+	for k := range q {
+		for _, p := range credentialParams {
+			if strings.EqualFold(k, p) {
+				q.Del(k)
+			}
+		}
+	}
+	if len(q) == 0 {
+		return u.Path
+	}
+	return u.Path + "?" + q.Encode()
+}
+
+func key(method, url, body string) string {
+	if body == "" {
+		return method + " " + url
+	}
+	return method + " " + url + " " + body
+}
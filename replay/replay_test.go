@@ -0,0 +1,174 @@
+package replay_test
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"imperva-waf-client"
+	"imperva-waf-client/impervatest"
+	"imperva-waf-client/replay"
+)
+
+// record runs fn against a fake server through a Recorder and returns the
+// recorded interactions.
+func record(t *testing.T, srv *impervatest.Server, fn func(*imperva.Client)) []replay.Interaction {
+	t.Helper()
+	var buf bytes.Buffer
+	client := srv.Client()
+	client.HTTPClient.Transport = replay.NewRecorder(&buf, nil)
+	fn(client)
+
+	interactions, err := replay.Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return interactions
+}
+
+// replayClient returns a client served by r, pointed at a host that does not resolve.
+func replayClient(r *replay.Replayer) *imperva.Client {
+	client := imperva.NewClient(&imperva.Config{Host: "http://replay.invalid", APIID: "id", APIKey: "key"})
+	client.Retry = nil
+	client.HTTPClient.Transport = r
+	return client
+}
+
+func newServer(t *testing.T) *impervatest.Server {
+	t.Helper()
+	srv := impervatest.NewServer()
+	t.Cleanup(srv.Close)
+	srv.AddSite(imperva.Site{SiteID: 1, Domain: "example.com"})
+	return srv
+}
+
+var (
+	ruleA = imperva.Rule{Name: "a", Action: imperva.RuleActionBlock, Filter: `URL == "/a"`}
+	ruleB = imperva.Rule{Name: "b", Action: imperva.RuleActionBlock, Filter: `URL == "/b"`}
+)
+
+func TestRoundTrip(t *testing.T) {
+	srv := newServer(t)
+	var created [2]*imperva.Rule
+	interactions := record(t, srv, func(client *imperva.Client) {
+		var err error
+		for i, r := range []imperva.Rule{ruleA, ruleB} {
+			if created[i], err = client.CreateRule(1, r); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := client.GetRule(1, created[0].ID); err != nil {
+			t.Fatal(err)
+		}
+		if err := client.DeleteRule(1, created[0].ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.ListRules(1); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if len(interactions) != 5 {
+		t.Fatalf("recorded %d interactions, want 5", len(interactions))
+	}
+
+	client := replayClient(replay.NewReplayer(interactions))
+
+	// The creations share method and path and are told apart by their body,
+	// whatever the order they are replayed in.
+	for _, i := range []int{1, 0} {
+		r, err := client.CreateRule(1, []imperva.Rule{ruleA, ruleB}[i])
+		if err != nil {
+			t.Fatalf("CreateRule(%s): %v", created[i].Name, err)
+		}
+		if r.ID != created[i].ID {
+			t.Errorf("CreateRule(%s) returned rule %d, want %d", created[i].Name, r.ID, created[i].ID)
+		}
+	}
+
+	// GET and DELETE share the path and are told apart by their method.
+	if err := client.DeleteRule(1, created[0].ID); err != nil {
+		t.Errorf("DeleteRule: %v", err)
+	}
+	r, err := client.GetRule(1, created[0].ID)
+	if err != nil {
+		t.Fatalf("GetRule: %v", err)
+	}
+	if r.Name != "a" {
+		t.Errorf("GetRule returned %q, want a", r.Name)
+	}
+
+	rules, err := client.ListRules(1)
+	if err != nil {
+		t.Fatalf("ListRules: %v", err)
+	}
+	if len(rules) != 1 || rules[0].Name != "b" {
+		t.Errorf("ListRules = %+v, want only rule b", rules)
+	}
+}
+
+func TestMissingRecording(t *testing.T) {
+	srv := newServer(t)
+	interactions := record(t, srv, func(client *imperva.Client) {
+		if _, err := client.CreateRule(1, ruleA); err != nil {
+			t.Fatal(err)
+		}
+	})
+	client := replayClient(replay.NewReplayer(interactions))
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{"other path", func() error { _, err := client.ListRules(1); return err }},
+		{"other body", func() error { _, err := client.CreateRule(1, ruleB); return err }},
+	}
+	for _, tt := range tests {
+		err := tt.call()
+		if err == nil || !strings.Contains(err.Error(), "no recorded interaction") {
+			t.Errorf("%s: err = %v, want no recorded interaction", tt.name, err)
+		}
+	}
+}
+
+// echoCredentials is a transport reflecting the request credentials in the
+// response headers, as a misbehaving proxy could.
+type echoCredentials struct{}
+
+func (echoCredentials) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Header.Set("x-API-Id", req.Header.Get("x-API-Id"))
+	resp.Header.Set("x-API-Key", req.Header.Get("x-API-Key"))
+	return resp, nil
+}
+
+func TestRecorderRedactsCredentials(t *testing.T) {
+	srv := newServer(t)
+	srv.APIID, srv.APIKey = "secret-id", "secret-key"
+
+	var buf bytes.Buffer
+	client := srv.Client()
+	client.HTTPClient.Transport = replay.NewRecorder(&buf, echoCredentials{})
+	if _, err := client.ListRules(1); err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/prov/v1/sites/list?api_id=secret-id&api_key=secret-key&page_size=10", nil)
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	cassette := buf.String()
+	for _, secret := range []string{"secret-id", "secret-key"} {
+		if strings.Contains(cassette, secret) {
+			t.Errorf("recording contains %q:\n%s", secret, cassette)
+		}
+	}
+	if !strings.Contains(cassette, "page_size=10") {
+		t.Errorf("recording lost the other query parameters:\n%s", cassette)
+	}
+}
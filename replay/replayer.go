@@ -0,0 +1,108 @@
+package replay
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Replayer is an http.RoundTripper serving recorded interactions.
+//
+// Requests are matched on method, path, query and body, credentials excluded.
+// Interactions sharing the same key are served in recording order; once they
+// are exhausted the last one keeps being served. A request without any
+// recorded match fails with an error.
+type Replayer struct {
+	mu     sync.Mutex
+	queues map[string][]Interaction
+}
+
+// NewReplayer returns a Replayer serving the given interactions.
+func NewReplayer(interactions []Interaction) *Replayer {
+	r := &Replayer{queues: map[string][]Interaction{}}
+	for _, in := range interactions {
+		k := key(in.Method, in.URL, in.RequestBody)
+		r.queues[k] = append(r.queues[k], in)
+	}
+	return r
+}
+
+// Read parses a JSONL stream of interactions.
+func Read(rd io.Reader) ([]Interaction, error) {
+	var out []Interaction
+	sc := bufio.NewScanner(rd)
+	sc.Buffer(make([]byte, 0, 64*1024), 32*1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		if len(strings.TrimSpace(sc.Text())) == 0 {
+			continue
+		}
+		var in Interaction
+		if err := json.Unmarshal(sc.Bytes(), &in); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		out = append(out, in)
+	}
+	return out, sc.Err()
+}
+
+// Load reads the JSONL file at path and returns a Replayer for it.
+func Load(path string) (*Replayer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	interactions, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return NewReplayer(interactions), nil
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	k := key(req.Method, normalizeURL(req.URL), string(body))
+	r.mu.Lock()
+	queue := r.queues[k]
+	if len(queue) == 0 {
+		r.mu.Unlock()
+		return nil, fmt.Errorf("replay: no recorded interaction for %s", k)
+	}
+	in := queue[0]
+	if len(queue) > 1 {
+		r.queues[k] = queue[1:]
+	}
+	r.mu.Unlock()
+
+	header := http.Header(in.Header).Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", in.Status, http.StatusText(in.Status)),
+		StatusCode:    in.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(in.Body)),
+		ContentLength: int64(len(in.Body)),
+		Request:       req,
+	}, nil
+}
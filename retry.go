@@ -0,0 +1,136 @@
+package imperva
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how Client.request retries failed attempts.
+//
+// Only idempotent methods (GET, PUT, DELETE, HEAD, OPTIONS) are retried by
+// default. Non-idempotent calls such as CreateRule are retried only when
+// RetryNonIdempotent is set or when the request context was wrapped with
+// WithRetry.
+type RetryPolicy struct {
+	MaxAttempts          int           // total attempts, including the first one
+	BaseDelay            time.Duration // delay before the first retry, doubled on each attempt
+	MaxDelay             time.Duration // upper bound for a single delay, including Retry-After
+	Jitter               float64       // fraction of the delay randomized away, between 0 and 1
+	RetryableStatusCodes []int
+	RetryNonIdempotent   bool
+}
+
+// DefaultRetryPolicy returns the policy used by NewClient.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: 4,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    30 * time.Second,
+		Jitter:      0.5,
+		RetryableStatusCodes: []int{
+			http.StatusTooManyRequests,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+	}
+}
+
+type retryKey struct{}
+
+// WithRetry marks requests made with ctx as safe to retry, regardless of
+// their HTTP method. Use it for POST calls you know to be idempotent.
+func WithRetry(ctx context.Context) context.Context {
+	return context.WithValue(ctx, retryKey{}, true)
+}
+
+func (p *RetryPolicy) attempts() int {
+	if p == nil || p.MaxAttempts < 1 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// allows reports whether a request with the given method and context may be retried.
+func (p *RetryPolicy) allows(ctx context.Context, method string) bool {
+	if p.attempts() <= 1 {
+		return false
+	}
+	if p.RetryNonIdempotent {
+		return true
+	}
+	if forced, _ := ctx.Value(retryKey{}).(bool); forced {
+		return true
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func (p *RetryPolicy) retryableStatus(code int) bool {
+	return slices.Contains(p.RetryableStatusCodes, code)
+}
+
+// backoff returns the delay to wait before the given retry (1 for the first retry).
+// A Retry-After header on resp takes precedence over the exponential delay.
+func (p *RetryPolicy) backoff(retry int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if d, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			return p.capDelay(d)
+		}
+	}
+
+	d := p.BaseDelay
+	for i := 1; i < retry && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	d = p.capDelay(d)
+
+	if p.Jitter > 0 && d > 0 {
+		j := min(p.Jitter, 1)
+		d -= time.Duration(rand.Float64() * j * float64(d))
+	}
+	return d
+}
+
+func (p *RetryPolicy) capDelay(d time.Duration) time.Duration {
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		return p.MaxDelay
+	}
+	return d
+}
+
+// parseRetryAfter parses a Retry-After header value, either in seconds or as an HTTP date.
+func parseRetryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
+
+// sleepContext waits for d or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
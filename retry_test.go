@@ -0,0 +1,133 @@
+package imperva
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyServer answers the first failures requests with status, then with a
+// successful envelope. It returns the server and its request counter.
+func flakyServer(t *testing.T, failures int, status int, header http.Header) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if int(calls.Add(1)) <= failures {
+			for k, vs := range header {
+				w.Header()[k] = vs
+			}
+			w.WriteHeader(status)
+			return
+		}
+		w.Write([]byte(`{"res":0,"res_message":"OK"}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func testClient(baseURL string) *Client {
+	c := NewClient(&Config{Host: baseURL})
+	c.Retry = &RetryPolicy{
+		MaxAttempts:          3,
+		BaseDelay:            time.Millisecond,
+		MaxDelay:             5 * time.Second,
+		RetryableStatusCodes: DefaultRetryPolicy().RetryableStatusCodes,
+	}
+	return c
+}
+
+func TestRetryRetryableStatus(t *testing.T) {
+	srv, calls := flakyServer(t, 2, http.StatusServiceUnavailable, nil)
+
+	if _, err := testClient(srv.URL).Get("/x"); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("attempts = %d, want 3", got)
+	}
+}
+
+func TestRetryGivesUpAfterMaxAttempts(t *testing.T) {
+	srv, calls := flakyServer(t, 10, http.StatusBadGateway, nil)
+
+	_, err := testClient(srv.URL).Get("/x")
+	if !errors.Is(err, ErrServer) {
+		t.Fatalf("err = %v, want ErrServer", err)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("attempts = %d, want 3", got)
+	}
+}
+
+func TestRetryNonRetryableStatus(t *testing.T) {
+	srv, calls := flakyServer(t, 1, http.StatusBadRequest, nil)
+
+	_, err := testClient(srv.URL).Get("/x")
+	if !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("err = %v, want ErrInvalidInput", err)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("attempts = %d, want 1", got)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	srv, calls := flakyServer(t, 1, http.StatusTooManyRequests, http.Header{"Retry-After": {"1"}})
+
+	start := time.Now()
+	if _, err := testClient(srv.URL).Get("/x"); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %v, want at least the 1s of Retry-After", elapsed)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("attempts = %d, want 2", got)
+	}
+}
+
+func TestRetryPOSTOptIn(t *testing.T) {
+	srv, calls := flakyServer(t, 1, http.StatusServiceUnavailable, nil)
+	c := testClient(srv.URL)
+
+	if _, err := c.Post("/x", nil); err == nil {
+		t.Fatal("POST without WithRetry succeeded, want the 503")
+	}
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("attempts without WithRetry = %d, want 1", got)
+	}
+
+	calls.Store(0)
+	if _, err := c.PostContext(WithRetry(context.Background()), "/x", nil); err != nil {
+		t.Fatalf("POST with WithRetry: %v", err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("attempts with WithRetry = %d, want 2", got)
+	}
+}
+
+func TestRetryContextCancelledDuringBackoff(t *testing.T) {
+	srv, calls := flakyServer(t, 10, http.StatusServiceUnavailable, nil)
+	c := testClient(srv.URL)
+	c.Retry.BaseDelay = time.Minute
+	c.Retry.MaxDelay = time.Minute
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := c.GetContext(ctx, "/x")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("returned after %v, want the backoff interrupted", elapsed)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("attempts = %d, want 1", got)
+	}
+}
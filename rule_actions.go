@@ -0,0 +1,175 @@
+package imperva
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// RuleActionDetails holds the fields specific to some rule actions. Which
+// fields are required depends on the action; see Rule.Validate.
+type RuleActionDetails struct {
+	// Redirect and rewrite actions.
+	From            string `json:"from,omitempty"`
+	To              string `json:"to,omitempty"`
+	RewriteExisting *bool  `json:"rewrite_existing,omitempty"`
+	AddMissing      *bool  `json:"add_missing,omitempty"`
+	// RewriteName is the header or cookie name for header and cookie actions.
+	RewriteName       string `json:"rewrite_name,omitempty"`
+	MultipleDeletions *bool  `json:"multiple_deletions,omitempty"`
+
+	// Forwarding actions.
+	DCID                  int    `json:"dc_id,omitempty"`
+	PortForwardingContext string `json:"port_forwarding_context,omitempty"` // "Use Port Value" or "Use Header Name"
+	PortForwardingValue   string `json:"port_forwarding_value,omitempty"`
+
+	// Rate counting action.
+	RateContext  RateContext  `json:"rate_context,omitempty"`
+	RateInterval RateInterval `json:"rate_interval,omitempty"` // in seconds
+
+	// Custom error response action.
+	ErrorType           string `json:"error_type,omitempty"`
+	ErrorResponseFormat string `json:"error_response_format,omitempty"` // "json" or "xml"
+	ErrorResponseData   string `json:"error_response_data,omitempty"`
+}
+
+// redirectCodes are the response codes accepted by redirect actions.
+var redirectCodes = []int{301, 302, 303, 307, 308}
+
+// actionRequirements lists, per action, the fields that must be set.
+var actionRequirements = map[string][]struct {
+	field string
+	set   func(Rule) bool
+}{
+	RuleActionRedirect: {
+		{"response_code", func(r Rule) bool { return r.ResponseCode != 0 }},
+		{"from", func(r Rule) bool { return r.From != "" }},
+		{"to", func(r Rule) bool { return r.To != "" }},
+	},
+	RuleActionSimplifiedRedirect: {
+		{"response_code", func(r Rule) bool { return r.ResponseCode != 0 }},
+		{"to", func(r Rule) bool { return r.To != "" }},
+	},
+	RuleActionRewriteURL: {
+		{"from", func(r Rule) bool { return r.From != "" }},
+		{"to", func(r Rule) bool { return r.To != "" }},
+	},
+	RuleActionRewriteHeader: {
+		{"rewrite_name", func(r Rule) bool { return r.RewriteName != "" }},
+		{"to", func(r Rule) bool { return r.To != "" }},
+	},
+	RuleActionRewriteCookie: {
+		{"rewrite_name", func(r Rule) bool { return r.RewriteName != "" }},
+		{"to", func(r Rule) bool { return r.To != "" }},
+	},
+	RuleActionResponseRewriteHeader: {
+		{"rewrite_name", func(r Rule) bool { return r.RewriteName != "" }},
+		{"to", func(r Rule) bool { return r.To != "" }},
+	},
+	RuleActionDeleteHeader: {
+		{"rewrite_name", func(r Rule) bool { return r.RewriteName != "" }},
+	},
+	RuleActionDeleteCookie: {
+		{"rewrite_name", func(r Rule) bool { return r.RewriteName != "" }},
+	},
+	RuleActionResponseDeleteHeader: {
+		{"rewrite_name", func(r Rule) bool { return r.RewriteName != "" }},
+	},
+	RuleActionResponseRewriteResponseCode: {
+		{"response_code", func(r Rule) bool { return r.ResponseCode != 0 }},
+	},
+	RuleActionForwardToDC: {
+		{"dc_id", func(r Rule) bool { return r.DCID != 0 }},
+	},
+	RuleActionForwardToPort: {
+		{"port_forwarding_context", func(r Rule) bool { return r.PortForwardingContext != "" }},
+		{"port_forwarding_value", func(r Rule) bool { return r.PortForwardingValue != "" }},
+	},
+	RuleActionRate: {
+		{"rate_context", func(r Rule) bool { return r.RateContext != "" }},
+		{"rate_interval", func(r Rule) bool { return r.RateInterval != 0 }},
+	},
+}
+
+// Validate checks that the rule has a name, a known action and the fields
+// required by its action. All problems are returned, joined with errors.Join.
+// The filter syntax is not checked; see the filter package for that.
+func (r Rule) Validate() error {
+	var errs []error
+	if r.Name == "" {
+		errs = append(errs, errors.New("missing name"))
+	}
+	if !IsKnownRuleAction(r.Action) {
+		errs = append(errs, fmt.Errorf("unknown action %q", r.Action))
+	}
+	for _, req := range actionRequirements[r.Action] {
+		if !req.set(r) {
+			errs = append(errs, fmt.Errorf("action %s requires %s", r.Action, req.field))
+		}
+	}
+	if (r.Action == RuleActionRedirect || r.Action == RuleActionSimplifiedRedirect) &&
+		r.ResponseCode != 0 && !slices.Contains(redirectCodes, r.ResponseCode) {
+		errs = append(errs, fmt.Errorf("action %s requires a redirect response code, got %d", r.Action, r.ResponseCode))
+	}
+	if r.Action == RuleActionRate {
+		errs = append(errs, r.validateRate()...)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid rule %q: %w", r.Name, err)
+	}
+	return nil
+}
+
+// NewRedirectRule returns a rule redirecting requests matching filter from
+// the URL pattern from to the URL to, with the given 3xx response code.
+func NewRedirectRule(name, filter, from, to string, responseCode int) Rule {
+	return Rule{
+		Name:              name,
+		Action:            RuleActionRedirect,
+		Filter:            filter,
+		ResponseCode:      responseCode,
+		RuleActionDetails: RuleActionDetails{From: from, To: to},
+	}
+}
+
+// NewRewriteURLRule returns a rule rewriting the URL pattern from to to.
+func NewRewriteURLRule(name, filter, from, to string) Rule {
+	return Rule{
+		Name:              name,
+		Action:            RuleActionRewriteURL,
+		Filter:            filter,
+		RuleActionDetails: RuleActionDetails{From: from, To: to},
+	}
+}
+
+// NewRewriteHeaderRule returns a rule setting the request header named
+// header to the value to, adding it when missing if addMissing is set.
+func NewRewriteHeaderRule(name, filter, header, to string, addMissing bool) Rule {
+	return Rule{
+		Name:              name,
+		Action:            RuleActionRewriteHeader,
+		Filter:            filter,
+		RuleActionDetails: RuleActionDetails{RewriteName: header, To: to, AddMissing: Bool(addMissing)},
+	}
+}
+
+// NewRewriteCookieRule returns a rule setting the cookie named cookie to the
+// value to, adding it when missing if addMissing is set.
+func NewRewriteCookieRule(name, filter, cookie, to string, addMissing bool) Rule {
+	return Rule{
+		Name:              name,
+		Action:            RuleActionRewriteCookie,
+		Filter:            filter,
+		RuleActionDetails: RuleActionDetails{RewriteName: cookie, To: to, AddMissing: Bool(addMissing)},
+	}
+}
+
+// NewForwardToDCRule returns a rule forwarding matching requests to the data center dcID.
+func NewForwardToDCRule(name, filter string, dcID int) Rule {
+	return Rule{
+		Name:              name,
+		Action:            RuleActionForwardToDC,
+		Filter:            filter,
+		RuleActionDetails: RuleActionDetails{DCID: dcID},
+	}
+}
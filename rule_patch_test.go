@@ -0,0 +1,35 @@
+package imperva_test
+
+import (
+	"net/http"
+	"testing"
+
+	"imperva-waf-client"
+	"imperva-waf-client/impervatest"
+)
+
+func TestPatchRuleValidatesFilterOnly(t *testing.T) {
+	srv := impervatest.NewServer()
+	defer srv.Close()
+	srv.AddSite(imperva.Site{SiteID: 1})
+	rule := srv.AddRule(1, imperva.Rule{Name: "block", Action: imperva.RuleActionBlock, Filter: `URL == "/admin"`})
+	client := srv.Client()
+	client.ValidateRules = true
+	client.ValidateFilters = true
+
+	filter := `URL == "/private"`
+	patched, err := client.PatchRule(1, rule.ID, imperva.RulePatch{Filter: &filter})
+	if err != nil {
+		t.Fatalf("PatchRule with a valid filter: %v", err)
+	}
+	if patched.Filter != filter || patched.Name != "block" {
+		t.Errorf("patched rule = %+v, want the new filter and the name kept", patched)
+	}
+
+	bad := `Nonsense ~~ 1`
+	n := srv.RequestCount(http.MethodPost, "/api/prov/v2/sites/1/rules/")
+	if _, err := client.PatchRule(1, rule.ID, imperva.RulePatch{Filter: &bad}); err == nil {
+		t.Error("PatchRule with an invalid filter succeeded")
+	}
+	srv.AssertCallCount(t, http.MethodPost, "/api/prov/v2/sites/1/rules/", n)
+}
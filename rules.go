@@ -1,8 +1,16 @@
 package imperva
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"iter"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"imperva-waf-client/filter"
 )
 
 // RuleAction constants
@@ -17,8 +25,58 @@ const (
 	RuleActionChallengeCaptcha   = "RULE_ACTION_CHALLENGE_CAPTCHA"
 	RuleActionAllow              = "RULE_ACTION_ALLOW"
 	RuleActionRewriteURL         = "RULE_ACTION_REWRITE_URL"
+
+	RuleActionBlock                       = "RULE_ACTION_BLOCK"
+	RuleActionAlert                       = "RULE_ACTION_ALERT"
+	RuleActionRetry                       = "RULE_ACTION_RETRY"
+	RuleActionIntrusiveHTML               = "RULE_ACTION_INTRUSIVE_HTML"
+	RuleActionRewriteHeader               = "RULE_ACTION_REWRITE_HEADER"
+	RuleActionRewriteCookie               = "RULE_ACTION_REWRITE_COOKIE"
+	RuleActionDeleteHeader                = "RULE_ACTION_DELETE_HEADER"
+	RuleActionDeleteCookie                = "RULE_ACTION_DELETE_COOKIE"
+	RuleActionResponseRewriteHeader       = "RULE_ACTION_RESPONSE_REWRITE_HEADER"
+	RuleActionResponseDeleteHeader        = "RULE_ACTION_RESPONSE_DELETE_HEADER"
+	RuleActionResponseRewriteResponseCode = "RULE_ACTION_RESPONSE_REWRITE_RESPONSE_CODE"
+	RuleActionForwardToDC                 = "RULE_ACTION_FORWARD_TO_DC"
+	RuleActionForwardToPort               = "RULE_ACTION_FORWARD_TO_PORT"
+	RuleActionRate                        = "RULE_ACTION_RATE"
+	RuleActionCustomErrorResponse         = "RULE_ACTION_CUSTOM_ERROR_RESPONSE"
 )
 
+// RuleActions lists the known rule actions.
+var RuleActions = []string{
+	RuleActionRedirect,
+	RuleActionSimplifiedRedirect,
+	RuleActionBlockIP,
+	RuleActionBlockUser,
+	RuleActionBlockSession,
+	RuleActionChallengeCookie,
+	RuleActionChallengeJS,
+	RuleActionChallengeCaptcha,
+	RuleActionAllow,
+	RuleActionRewriteURL,
+	RuleActionBlock,
+	RuleActionAlert,
+	RuleActionRetry,
+	RuleActionIntrusiveHTML,
+	RuleActionRewriteHeader,
+	RuleActionRewriteCookie,
+	RuleActionDeleteHeader,
+	RuleActionDeleteCookie,
+	RuleActionResponseRewriteHeader,
+	RuleActionResponseDeleteHeader,
+	RuleActionResponseRewriteResponseCode,
+	RuleActionForwardToDC,
+	RuleActionForwardToPort,
+	RuleActionRate,
+	RuleActionCustomErrorResponse,
+}
+
+// IsKnownRuleAction reports whether action is one of RuleActions.
+func IsKnownRuleAction(action string) bool {
+	return slices.Contains(RuleActions, action)
+}
+
 // BlockDurationDetails defines details for blocking actions.
 type BlockDurationDetails struct {
 	BlockDurationPeriodType string `json:"blockDurationPeriodType,omitempty"` // "fixed" or "custom"
@@ -32,14 +90,56 @@ type Rule struct {
 	Action               string                `json:"action,omitempty"`
 	Filter               string                `json:"filter,omitempty"`
 	ResponseCode         int                   `json:"response_code,omitempty"`
-	Enabled              bool                  `json:"enabled,omitempty"` // v3 field
+	Enabled              *bool                 `json:"enabled,omitempty"` // v3 field; nil leaves it unchanged on update
 	BlockDurationDetails *BlockDurationDetails `json:"blockDurationDetails,omitempty"`
+	RuleActionDetails
+}
+
+// Bool returns a pointer to b, for the optional boolean fields of Rule.
+func Bool(b bool) *bool {
+	return &b
+}
+
+// IsEnabled reports whether the rule is enabled. Rules are enabled unless
+// Enabled is explicitly false.
+func (r Rule) IsEnabled() bool {
+	return r.Enabled == nil || *r.Enabled
+}
+
+// checkRule validates the rule locally when the client is configured to.
+func (c *Client) checkRule(rule Rule) error {
+	if c.ValidateRules {
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+	}
+	return c.checkFilter(rule.Name, rule.Filter)
+}
+
+// checkFilter validates the filter of the named rule when the client is
+// configured to.
+func (c *Client) checkFilter(name, f string) error {
+	if !c.ValidateFilters || f == "" {
+		return nil
+	}
+	if err := filter.Validate(f); err != nil {
+		return fmt.Errorf("invalid filter for rule %q: %w", name, err)
+	}
+	return nil
 }
 
 // CreateRule creates a new custom rule for a site.
 func (c *Client) CreateRule(siteID int, rule Rule) (*Rule, error) {
+	return c.CreateRuleContext(context.Background(), siteID, rule)
+}
+
+// CreateRuleContext is like CreateRule but carries ctx for cancellation and deadlines.
+func (c *Client) CreateRuleContext(ctx context.Context, siteID int, rule Rule) (*Rule, error) {
+	if err := c.checkRule(rule); err != nil {
+		return nil, err
+	}
 	path := fmt.Sprintf("/api/prov/v2/sites/%d/rules", siteID)
-	respBody, err := c.Post(path, rule)
+	respBody, err := c.PostContext(ctx, path, rule)
 	if err != nil {
 		return nil, err
 	}
@@ -48,13 +148,18 @@ func (c *Client) CreateRule(siteID int, rule Rule) (*Rule, error) {
 	if err := json.Unmarshal(respBody, &createdRule); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal create rule response: %w", err)
 	}
-	return &createdRule, nil
+	return &createdRule, c.journal(ctx, JournalCreate, siteID, createdRule.ID, nil, &createdRule)
 }
 
 // GetRule retrieves a specific rule by ID.
 func (c *Client) GetRule(siteID int, ruleID int) (*Rule, error) {
+	return c.GetRuleContext(context.Background(), siteID, ruleID)
+}
+
+// GetRuleContext is like GetRule but carries ctx for cancellation and deadlines.
+func (c *Client) GetRuleContext(ctx context.Context, siteID int, ruleID int) (*Rule, error) {
 	path := fmt.Sprintf("/api/prov/v2/sites/%d/rules/%d", siteID, ruleID)
-	respBody, err := c.Get(path)
+	respBody, err := c.GetContext(ctx, path)
 	if err != nil {
 		return nil, err
 	}
@@ -68,8 +173,17 @@ func (c *Client) GetRule(siteID int, ruleID int) (*Rule, error) {
 
 // UpdateRule updates an existing rule.
 func (c *Client) UpdateRule(siteID int, ruleID int, rule Rule) (*Rule, error) {
+	return c.UpdateRuleContext(context.Background(), siteID, ruleID, rule)
+}
+
+// UpdateRuleContext is like UpdateRule but carries ctx for cancellation and deadlines.
+func (c *Client) UpdateRuleContext(ctx context.Context, siteID int, ruleID int, rule Rule) (*Rule, error) {
+	if err := c.checkRule(rule); err != nil {
+		return nil, err
+	}
+	before := c.journalBefore(ctx, siteID, ruleID)
 	path := fmt.Sprintf("/api/prov/v2/sites/%d/rules/%d", siteID, ruleID)
-	respBody, err := c.Post(path, rule)
+	respBody, err := c.PostContext(ctx, path, rule)
 	if err != nil {
 		return nil, err
 	}
@@ -78,58 +192,202 @@ func (c *Client) UpdateRule(siteID int, ruleID int, rule Rule) (*Rule, error) {
 	if err := json.Unmarshal(respBody, &updatedRule); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal update rule response: %w", err)
 	}
-	return &updatedRule, nil
+	return &updatedRule, c.journal(ctx, JournalUpdate, siteID, ruleID, before, &updatedRule)
 }
 
-// DeleteRule deletes a rule.
-func (c *Client) DeleteRule(siteID int, ruleID int) error {
+// OverwriteRule replaces an existing rule with rule. Unlike UpdateRule,
+// fields left empty in rule are cleared rather than kept.
+func (c *Client) OverwriteRule(siteID int, ruleID int, rule Rule) (*Rule, error) {
+	return c.OverwriteRuleContext(context.Background(), siteID, ruleID, rule)
+}
+
+// OverwriteRuleContext is like OverwriteRule but carries ctx for cancellation and deadlines.
+func (c *Client) OverwriteRuleContext(ctx context.Context, siteID int, ruleID int, rule Rule) (*Rule, error) {
+	if err := c.checkRule(rule); err != nil {
+		return nil, err
+	}
+	before := c.journalBefore(ctx, siteID, ruleID)
 	path := fmt.Sprintf("/api/prov/v2/sites/%d/rules/%d", siteID, ruleID)
-	respBody, err := c.Delete(path, nil)
+	respBody, err := c.PutContext(ctx, path, rule)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	var apiRes APIResponse
-	if err := json.Unmarshal(respBody, &apiRes); err != nil {
-		return fmt.Errorf("failed to unmarshal delete rule response: %w", err)
+	var overwritten Rule
+	if err := json.Unmarshal(respBody, &overwritten); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal overwrite rule response: %w", err)
 	}
+	return &overwritten, c.journal(ctx, JournalUpdate, siteID, ruleID, before, &overwritten)
+}
 
-	if apiRes.Res != 0 {
-		return fmt.Errorf("delete rule failed: %s (%d)", apiRes.ResMessage, apiRes.Res)
+// DeleteRule deletes a rule.
+func (c *Client) DeleteRule(siteID int, ruleID int) error {
+	return c.DeleteRuleContext(context.Background(), siteID, ruleID)
+}
+
+// DeleteRuleContext is like DeleteRule but carries ctx for cancellation and deadlines.
+func (c *Client) DeleteRuleContext(ctx context.Context, siteID int, ruleID int) error {
+	before := c.journalBefore(ctx, siteID, ruleID)
+	path := fmt.Sprintf("/api/prov/v2/sites/%d/rules/%d", siteID, ruleID)
+	// A non-zero "res" in the response is reported by the client as an *APIError.
+	if _, err := c.DeleteContext(ctx, path, nil); err != nil {
+		return err
 	}
-	return nil
+	return c.journal(ctx, JournalDelete, siteID, ruleID, before, nil)
+}
+
+// rulesPageSize is the page size used when walking the v3 rules listing.
+const rulesPageSize = 100
+
+// v3RuleItem is an entry of the v3 rules listing.
+type v3RuleItem struct {
+	Rule      Rule `json:"rule"`
+	SiteID    int  `json:"site_id"`
+	AccountID int  `json:"account_id"`
+}
+
+// v3ListMeta is the pagination metadata of the v3 rules listing.
+type v3ListMeta struct {
+	PageNum    int `json:"page_num"`
+	PageSize   int `json:"page_size"`
+	TotalPages int `json:"total_pages"`
+	TotalItems int `json:"total_items"`
+}
+
+type v3ListResponse struct {
+	Data []v3RuleItem `json:"data"`
+	Meta *v3ListMeta  `json:"meta,omitempty"`
 }
 
-// ListRules lists all rules for a site using the v3 API.
+// ListRules lists all rules for a site using the v3 API, walking every page.
 func (c *Client) ListRules(siteID int) ([]Rule, error) {
-	// Using v3 API: GET /api/prov/v3/rules?siteIds=...
-	path := fmt.Sprintf("/api/prov/v3/rules?siteIds=%d&page_size=100", siteID)
+	return c.ListRulesContext(context.Background(), siteID)
+}
 
-	respBody, err := c.Get(path)
-	if err != nil {
-		return nil, err
+// ListRulesContext is like ListRules but carries ctx for cancellation and deadlines.
+func (c *Client) ListRulesContext(ctx context.Context, siteID int) ([]Rule, error) {
+	var rules []Rule
+	for rule, err := range c.IterRules(ctx, siteID) {
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
 	}
+	return rules, nil
+}
 
-	type V3RuleItem struct {
-		Rule      Rule `json:"rule"`
-		SiteID    int  `json:"site_id"`
-		AccountID int  `json:"account_id"`
+// IterRules returns an iterator over the rules of a site, fetching pages of
+// the v3 listing lazily as the caller advances. Iteration stops after the
+// first error, which is yielded with a zero Rule.
+func (c *Client) IterRules(ctx context.Context, siteID int) iter.Seq2[Rule, error] {
+	return func(yield func(Rule, error) bool) {
+		for item, err := range c.iterRuleItems(ctx, []int{siteID}) {
+			if !yield(item.Rule, err) || err != nil {
+				return
+			}
+		}
 	}
+}
+
+// iterRuleItems walks the v3 rules listing for siteIDs page by page.
+func (c *Client) iterRuleItems(ctx context.Context, siteIDs []int) iter.Seq2[v3RuleItem, error] {
+	return func(yield func(v3RuleItem, error) bool) {
+		ids := make([]string, len(siteIDs))
+		for i, id := range siteIDs {
+			ids[i] = strconv.Itoa(id)
+		}
 
-	type V3ListResponse struct {
-		Data []V3RuleItem `json:"data"`
-		Meta interface{}  `json:"meta,omitempty"`
+		for pageNum := 0; ; pageNum++ {
+			page, err := c.listRulesPage(ctx, strings.Join(ids, ","), pageNum)
+			if err != nil {
+				yield(v3RuleItem{}, err)
+				return
+			}
+			for _, item := range page.Data {
+				if !yield(item, nil) {
+					return
+				}
+			}
+
+			// Prefer the pagination metadata; fall back on a short page
+			// marking the end when the API does not send it.
+			if page.Meta != nil && page.Meta.TotalPages > 0 {
+				if pageNum+1 >= page.Meta.TotalPages {
+					return
+				}
+			} else if len(page.Data) < rulesPageSize {
+				return
+			}
+			if len(page.Data) == 0 {
+				return
+			}
+		}
+	}
+}
+
+// listRulesPage fetches a single page of the v3 rules listing.
+func (c *Client) listRulesPage(ctx context.Context, siteIDs string, pageNum int) (*v3ListResponse, error) {
+	// Using v3 API: GET /api/prov/v3/rules?siteIds=...
+	u := url.Values{}
+	u.Set("siteIds", siteIDs)
+	u.Set("page_size", strconv.Itoa(rulesPageSize))
+	u.Set("page_num", strconv.Itoa(pageNum))
+	path := "/api/prov/v3/rules?" + u.Encode()
+
+	respBody, err := c.GetContext(ctx, path)
+	if err != nil {
+		return nil, err
 	}
 
-	var wrapper V3ListResponse
+	var wrapper v3ListResponse
 	if err := json.Unmarshal(respBody, &wrapper); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal list rules response: %w", err)
 	}
+	return &wrapper, nil
+}
 
-	var rules []Rule
-	for _, item := range wrapper.Data {
-		rules = append(rules, item.Rule)
+// maxSitesPerRulesRequest bounds how many site IDs are sent in one v3 rules listing.
+const maxSitesPerRulesRequest = 50
+
+// SiteRule is a rule along with the site and account it belongs to.
+type SiteRule struct {
+	Rule
+	SiteID    int `json:"site_id"`
+	AccountID int `json:"account_id"`
+}
+
+// RuleQuery filters the rules returned by ListRulesForSites.
+// Filtering is done client-side; zero fields match every rule.
+type RuleQuery struct {
+	Actions      []string // keep rules whose action is one of these
+	NameContains string   // keep rules whose name contains this substring
+}
+
+func (q RuleQuery) match(r Rule) bool {
+	if len(q.Actions) > 0 && !slices.Contains(q.Actions, r.Action) {
+		return false
 	}
+	return strings.Contains(r.Name, q.NameContains)
+}
+
+// ListRulesForSites lists the rules of several sites through the v3 API,
+// batching site IDs and walking every page.
+func (c *Client) ListRulesForSites(siteIDs []int, query RuleQuery) ([]SiteRule, error) {
+	return c.ListRulesForSitesContext(context.Background(), siteIDs, query)
+}
 
+// ListRulesForSitesContext is like ListRulesForSites but carries ctx for cancellation and deadlines.
+func (c *Client) ListRulesForSitesContext(ctx context.Context, siteIDs []int, query RuleQuery) ([]SiteRule, error) {
+	var rules []SiteRule
+	for batch := range slices.Chunk(siteIDs, maxSitesPerRulesRequest) {
+		for item, err := range c.iterRuleItems(ctx, batch) {
+			if err != nil {
+				return nil, err
+			}
+			if query.match(item.Rule) {
+				rules = append(rules, SiteRule{Rule: item.Rule, SiteID: item.SiteID, AccountID: item.AccountID})
+			}
+		}
+	}
 	return rules, nil
 }
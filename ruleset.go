@@ -0,0 +1,269 @@
+package imperva
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"imperva-waf-client/filter"
+)
+
+// RuleSetVersion is the version of the rule-set file format written by this package.
+const RuleSetVersion = 1
+
+// RuleSet is the on-disk description of the custom rules of one or more sites,
+// used to back up, review and migrate rule sets.
+type RuleSet struct {
+	Version    int           `json:"version"`
+	ExportedAt *time.Time    `json:"exported_at,omitempty"`
+	Sites      []SiteRuleSet `json:"sites"`
+}
+
+// SiteRuleSet holds the rules of a site.
+type SiteRuleSet struct {
+	SiteID int        `json:"site_id"`
+	Domain string     `json:"domain,omitempty"`
+	Rules  []RuleSpec `json:"rules"`
+}
+
+// RuleSpec is a rule in a rule-set file.
+type RuleSpec struct {
+	Name          string                `json:"name"`
+	Action        string                `json:"action"`
+	Filter        string                `json:"filter"`
+	ResponseCode  int                   `json:"response_code,omitempty"`
+	BlockDuration *BlockDurationDetails `json:"block_duration,omitempty"`
+	Enabled       *bool                 `json:"enabled,omitempty"` // true when omitted
+	RuleActionDetails
+}
+
+// NewRuleSpec returns the file representation of r.
+func NewRuleSpec(r Rule) RuleSpec {
+	return RuleSpec{
+		Name:          r.Name,
+		Action:        r.Action,
+		Filter:        r.Filter,
+		ResponseCode:  r.ResponseCode,
+		BlockDuration: r.BlockDurationDetails,
+		Enabled:       Bool(r.IsEnabled()),
+
+		RuleActionDetails: r.RuleActionDetails,
+	}
+}
+
+// Rule returns the API representation of the spec.
+func (s RuleSpec) Rule() Rule {
+	enabled := true
+	if s.Enabled != nil {
+		enabled = *s.Enabled
+	}
+	return Rule{
+		Name:                 s.Name,
+		Action:               s.Action,
+		Filter:               s.Filter,
+		ResponseCode:         s.ResponseCode,
+		BlockDurationDetails: s.BlockDuration,
+		Enabled:              Bool(enabled),
+		RuleActionDetails:    s.RuleActionDetails,
+	}
+}
+
+// APIRules returns the API representation of the rules of the site.
+func (s SiteRuleSet) APIRules() []Rule {
+	rules := make([]Rule, len(s.Rules))
+	for i, spec := range s.Rules {
+		rules[i] = spec.Rule()
+	}
+	return rules
+}
+
+// Validate checks the rule set: supported version, unique sites, unique and
+// non-empty rule names, known actions with their required fields and filter
+// syntax. Filter parameters and values are not checked against the filter
+// package tables, which do not list every parameter the API accepts; see
+// CheckFilters for that. All problems are returned, joined with errors.Join.
+func (rs *RuleSet) Validate() error {
+	var errs []error
+	if rs.Version != RuleSetVersion {
+		errs = append(errs, fmt.Errorf("unsupported rule set version %d, expected %d", rs.Version, RuleSetVersion))
+	}
+
+	sites := map[int]bool{}
+	for _, site := range rs.Sites {
+		if sites[site.SiteID] {
+			errs = append(errs, fmt.Errorf("site %d: listed more than once", site.SiteID))
+		}
+		sites[site.SiteID] = true
+
+		names := map[string]bool{}
+		for i, spec := range site.Rules {
+			where := fmt.Sprintf("site %d: rule #%d", site.SiteID, i+1)
+			if spec.Name != "" && names[spec.Name] {
+				errs = append(errs, fmt.Errorf("%s: duplicate name %q", where, spec.Name))
+			}
+			names[spec.Name] = true
+
+			// Checks the name, the action and its required fields.
+			if err := spec.Rule().Validate(); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", where, err))
+			}
+			// Some rules, such as simplified redirects, have no filter.
+			if spec.Filter == "" {
+				continue
+			}
+			if _, err := filter.Parse(spec.Filter); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", where, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// CheckFilters checks the parameters, operators and values of the rule
+// filters against the filter package tables. Unlike Validate, it reports
+// parameters unknown to the tables, which the API may still accept.
+func (rs *RuleSet) CheckFilters() error {
+	var errs []error
+	for _, site := range rs.Sites {
+		for i, spec := range site.Rules {
+			if spec.Filter == "" {
+				continue
+			}
+			if err := filter.Validate(spec.Filter); err != nil {
+				errs = append(errs, fmt.Errorf("site %d: rule #%d: %w", site.SiteID, i+1, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ReadRuleSet decodes and validates a rule set.
+func ReadRuleSet(r io.Reader) (*RuleSet, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	var rs RuleSet
+	if err := dec.Decode(&rs); err != nil {
+		return nil, fmt.Errorf("failed to decode rule set: %w", err)
+	}
+	if err := rs.Validate(); err != nil {
+		return nil, err
+	}
+	return &rs, nil
+}
+
+// LoadRuleSet reads and validates the rule-set file at path.
+func LoadRuleSet(path string) (*RuleSet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadRuleSet(f)
+}
+
+// WriteRuleSet encodes rs as indented JSON.
+func WriteRuleSet(w io.Writer, rs *RuleSet) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(rs)
+}
+
+// SaveRuleSet writes rs to the file at path.
+func SaveRuleSet(path string, rs *RuleSet) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := WriteRuleSet(f, rs); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ExportRules builds a rule set from the current rules of the given sites.
+func (c *Client) ExportRules(siteIDs ...int) (*RuleSet, error) {
+	return c.ExportRulesContext(context.Background(), siteIDs...)
+}
+
+// ExportRulesContext is like ExportRules but carries ctx for cancellation and deadlines.
+func (c *Client) ExportRulesContext(ctx context.Context, siteIDs ...int) (*RuleSet, error) {
+	now := time.Now().UTC()
+	rs := &RuleSet{Version: RuleSetVersion, ExportedAt: &now}
+	for _, siteID := range siteIDs {
+		rules, err := c.ListRulesContext(ctx, siteID)
+		if err != nil {
+			return nil, fmt.Errorf("site %d: %w", siteID, err)
+		}
+		site := SiteRuleSet{SiteID: siteID, Rules: make([]RuleSpec, 0, len(rules))}
+		for _, r := range rules {
+			site.Rules = append(site.Rules, NewRuleSpec(r))
+		}
+		rs.Sites = append(rs.Sites, site)
+	}
+	return rs, nil
+}
+
+// ImportOptions controls ImportRules.
+type ImportOptions struct {
+	// SiteMap redirects the rules of a site of the file to another site,
+	// e.g. from a staging site ID to the production one.
+	SiteMap map[int]int
+	Plan    PlanOptions
+	Apply   ApplyOptions
+	// DryRun computes the plans without applying them.
+	DryRun bool
+	// StrictFilters rejects rule sets failing CheckFilters.
+	StrictFilters bool
+}
+
+// SiteImport is the outcome of importing the rules of one site.
+type SiteImport struct {
+	Plan    *Plan
+	Results []ApplyResult
+}
+
+// ImportRules validates rs and reconciles every site it lists with its rules.
+func (c *Client) ImportRules(rs *RuleSet, opts ImportOptions) ([]SiteImport, error) {
+	return c.ImportRulesContext(context.Background(), rs, opts)
+}
+
+// ImportRulesContext is like ImportRules but carries ctx for cancellation and deadlines.
+func (c *Client) ImportRulesContext(ctx context.Context, rs *RuleSet, opts ImportOptions) ([]SiteImport, error) {
+	if err := rs.Validate(); err != nil {
+		return nil, err
+	}
+	if opts.StrictFilters {
+		if err := rs.CheckFilters(); err != nil {
+			return nil, err
+		}
+	}
+
+	var out []SiteImport
+	for _, site := range rs.Sites {
+		siteID := site.SiteID
+		if to, ok := opts.SiteMap[siteID]; ok {
+			siteID = to
+		}
+
+		plan, err := c.PlanRulesContext(ctx, siteID, site.APIRules(), opts.Plan)
+		if err != nil {
+			return out, fmt.Errorf("site %d: %w", siteID, err)
+		}
+		imp := SiteImport{Plan: plan}
+		if !opts.DryRun {
+			imp.Results, err = c.ApplyPlanContext(ctx, plan, opts.Apply)
+		}
+		out = append(out, imp)
+		if err != nil {
+			return out, fmt.Errorf("site %d: %w", siteID, err)
+		}
+	}
+	return out, nil
+}
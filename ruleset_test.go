@@ -0,0 +1,65 @@
+package imperva_test
+
+import (
+	"bytes"
+	"testing"
+
+	"imperva-waf-client"
+	"imperva-waf-client/impervatest"
+)
+
+func TestRuleSetValidateAllowsUnknownParameters(t *testing.T) {
+	rs := &imperva.RuleSet{
+		Version: imperva.RuleSetVersion,
+		Sites: []imperva.SiteRuleSet{{
+			SiteID: 1,
+			Rules: []imperva.RuleSpec{
+				{Name: "bots", Action: imperva.RuleActionBlock, Filter: `ClientType == "Bad Bot"`},
+			},
+		}},
+	}
+	if err := rs.Validate(); err != nil {
+		t.Errorf("Validate: %v, want unknown parameters accepted", err)
+	}
+	if err := rs.CheckFilters(); err == nil {
+		t.Error("CheckFilters accepted an unknown parameter")
+	}
+
+	rs.Sites[0].Rules[0].Filter = `URL == "/a" &`
+	if err := rs.Validate(); err == nil {
+		t.Error("Validate accepted a filter syntax error")
+	}
+}
+
+func TestRuleSetRoundTripWithoutFilter(t *testing.T) {
+	srv := impervatest.NewServer()
+	defer srv.Close()
+	srv.AddSite(imperva.Site{SiteID: 1})
+	srv.AddSite(imperva.Site{SiteID: 2})
+	srv.AddRule(1, imperva.Rule{
+		Name:              "old home",
+		Action:            imperva.RuleActionSimplifiedRedirect,
+		ResponseCode:      301,
+		RuleActionDetails: imperva.RuleActionDetails{From: "/home", To: "/"},
+	})
+	client := srv.Client()
+
+	rs, err := client.ExportRules(1)
+	if err != nil {
+		t.Fatalf("ExportRules: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := imperva.WriteRuleSet(&buf, rs); err != nil {
+		t.Fatalf("WriteRuleSet: %v", err)
+	}
+	rs, err = imperva.ReadRuleSet(&buf)
+	if err != nil {
+		t.Fatalf("ReadRuleSet: %v", err)
+	}
+	if _, err := client.ImportRules(rs, imperva.ImportOptions{SiteMap: map[int]int{1: 2}, StrictFilters: true}); err != nil {
+		t.Fatalf("ImportRules: %v", err)
+	}
+	if rules := srv.Rules(2); len(rules) != 1 || rules[0].To != "/" || rules[0].Filter != "" {
+		t.Errorf("imported rules = %+v, want the redirect without a filter", rules)
+	}
+}
@@ -1,12 +1,19 @@
 package imperva
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 )
 
 // ReleaseSession releases a blocked session.
 func (c *Client) ReleaseSession(siteID int, sessionID string) (*APIResponse, error) {
+	return c.ReleaseSessionContext(context.Background(), siteID, sessionID)
+}
+
+// ReleaseSessionContext is like ReleaseSession but carries ctx for cancellation and deadlines.
+func (c *Client) ReleaseSessionContext(ctx context.Context, siteID int, sessionID string) (*APIResponse, error) {
 	// Documentation extracted: /v3/sites/{siteId}/sessions/{sessionId}/release
 	path := fmt.Sprintf("/v3/sites/%d/sessions/%s/release", siteID, sessionID)
 
@@ -14,7 +21,7 @@ func (c *Client) ReleaseSession(siteID int, sessionID string) (*APIResponse, err
 	// The extraction said caid is optional query param.
 	// Let's rely on headers x-API-Id/Key being sufficient or AccountID config.
 
-	respBody, err := c.Post(path, nil)
+	respBody, err := c.PostContext(ctx, path, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -37,6 +44,9 @@ func (c *Client) ReleaseSession(siteID int, sessionID string) (*APIResponse, err
 	}
 
 	if len(wrapper.Data) > 0 {
+		if wrapper.Data[0].Res != ResOK {
+			return nil, newResError(http.MethodPost, path, wrapper.Data[0])
+		}
 		return &wrapper.Data[0], nil
 	}
 
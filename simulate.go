@@ -0,0 +1,147 @@
+package imperva
+
+import (
+	"context"
+	"strings"
+
+	"imperva-waf-client/filter"
+)
+
+// SimulateOptions controls rule simulation.
+type SimulateOptions struct {
+	MaxSamples   int  // matched visits kept per rule, 5 when zero
+	SkipDisabled bool // ignore disabled rules
+}
+
+// RuleSimulation is the outcome of replaying visits through one rule.
+type RuleSimulation struct {
+	Rule    Rule
+	Matches int     // number of visits matched
+	Samples []Visit // first matched visits
+	Err     error   // set when the rule filter could not be compiled
+}
+
+// SimulationResult is the outcome of Simulate.
+type SimulationResult struct {
+	Visits int
+	Rules  []RuleSimulation
+}
+
+// Simulate replays visits through rules, as a dry run of a rule set.
+// A visit matches a rule when the rule filter matches any request of the
+// visit, from any of its client IPs. Rules are evaluated independently, so a
+// visit can be counted by several rules.
+func Simulate(rules []Rule, visits []Visit, opts SimulateOptions) *SimulationResult {
+	if opts.MaxSamples == 0 {
+		opts.MaxSamples = 5
+	}
+
+	res := &SimulationResult{Visits: len(visits)}
+	for _, rule := range rules {
+		if !rule.IsEnabled() && opts.SkipDisabled {
+			continue
+		}
+		sim := RuleSimulation{Rule: rule}
+		prog, err := filter.Compile(rule.Filter)
+		if err != nil {
+			sim.Err = err
+			res.Rules = append(res.Rules, sim)
+			continue
+		}
+		for _, v := range visits {
+			if !visitMatches(prog, v) {
+				continue
+			}
+			sim.Matches++
+			if len(sim.Samples) < opts.MaxSamples {
+				sim.Samples = append(sim.Samples, v)
+			}
+		}
+		res.Rules = append(res.Rules, sim)
+	}
+	return res
+}
+
+// EvaluateRule reports whether the filter of rule matches a request with attributes a.
+func EvaluateRule(rule Rule, a filter.Attributes) (bool, error) {
+	prog, err := filter.Compile(rule.Filter)
+	if err != nil {
+		return false, err
+	}
+	return prog.Match(a), nil
+}
+
+// VisitAttributes returns the filter attributes of every request of v,
+// one per client IP and action.
+func VisitAttributes(v Visit) []filter.Attributes {
+	base := filter.Attributes{
+		UserAgent: v.UserAgent,
+		Referrer:  v.EntryReferer,
+	}
+
+	ips := v.ClientIPs
+	if len(ips) == 0 {
+		ips = []string{""}
+	}
+
+	var out []filter.Attributes
+	for i, ip := range ips {
+		a := base
+		a.ClientIP = ip
+		// Country codes are reported along with client IPs.
+		if i < len(v.CountryCode) {
+			a.CountryCode = v.CountryCode[i]
+		} else if len(v.CountryCode) > 0 {
+			a.CountryCode = v.CountryCode[0]
+		}
+
+		if len(v.Actions) == 0 {
+			out = append(out, a)
+			continue
+		}
+		for _, act := range v.Actions {
+			aa := a
+			aa.Method = act.HTTPMethod
+			aa.URL, aa.QueryString = splitActionURL(act.URL)
+			out = append(out, aa)
+		}
+	}
+	return out
+}
+
+// splitActionURL turns "example.com/path?query" into its path and query.
+func splitActionURL(raw string) (path, query string) {
+	if i := strings.Index(raw, "://"); i >= 0 {
+		raw = raw[i+3:]
+	}
+	if i := strings.IndexByte(raw, '/'); i >= 0 {
+		raw = raw[i:]
+	} else {
+		raw = "/"
+	}
+	path, query, _ = strings.Cut(raw, "?")
+	return path, query
+}
+
+func visitMatches(prog *filter.Program, v Visit) bool {
+	for _, a := range VisitAttributes(v) {
+		if prog.Match(a) {
+			return true
+		}
+	}
+	return false
+}
+
+// SimulateRules fetches visits of a site and replays them through rules.
+func (c *Client) SimulateRules(siteID int, rules []Rule, visitOpts VisitOptions, opts SimulateOptions) (*SimulationResult, error) {
+	return c.SimulateRulesContext(context.Background(), siteID, rules, visitOpts, opts)
+}
+
+// SimulateRulesContext is like SimulateRules but carries ctx for cancellation and deadlines.
+func (c *Client) SimulateRulesContext(ctx context.Context, siteID int, rules []Rule, visitOpts VisitOptions, opts SimulateOptions) (*SimulationResult, error) {
+	visits, err := c.GetVisitsContext(ctx, siteID, visitOpts)
+	if err != nil {
+		return nil, err
+	}
+	return Simulate(rules, visits, opts), nil
+}
@@ -0,0 +1,20 @@
+package imperva_test
+
+import (
+	"testing"
+
+	"imperva-waf-client"
+)
+
+func TestSimulateRuleWithoutFilter(t *testing.T) {
+	visits := []imperva.Visit{
+		{ClientIPs: []string{"1.2.3.4"}},
+		{ClientIPs: []string{"5.6.7.8"}},
+	}
+	rules := []imperva.Rule{{Name: "redirect all", Action: imperva.RuleActionSimplifiedRedirect}}
+
+	res := imperva.Simulate(rules, visits, imperva.SimulateOptions{})
+	if sim := res.Rules[0]; sim.Err != nil || sim.Matches != 2 {
+		t.Errorf("simulation = %+v, want every visit matched", sim)
+	}
+}
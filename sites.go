@@ -1,9 +1,11 @@
 package imperva
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/url"
+	"strconv"
 )
 
 // Site represents an Imperva site configuration.
@@ -67,6 +69,11 @@ func (s *Site) IsActive() bool {
 
 // ListSites lists all sites for the account.
 func (c *Client) ListSites(options map[string]string) ([]Site, error) {
+	return c.ListSitesContext(context.Background(), options)
+}
+
+// ListSitesContext is like ListSites but carries ctx for cancellation and deadlines.
+func (c *Client) ListSitesContext(ctx context.Context, options map[string]string) ([]Site, error) {
 	u := url.Values{}
 	// Default pagination
 	pageSize := "100"
@@ -89,7 +96,8 @@ func (c *Client) ListSites(options map[string]string) ([]Site, error) {
 
 	// API is POST with Query Parameters and Empty JSON Body.
 	// Sending {} ensures valid JSON content type usage.
-	respBody, err := c.Post(path, map[string]string{})
+	// Listing is read-only, so the POST can be retried.
+	respBody, err := c.PostContext(WithRetry(ctx), path, map[string]string{})
 	if err != nil {
 		return nil, err
 	}
@@ -103,12 +111,6 @@ func (c *Client) ListSites(options map[string]string) ([]Site, error) {
 		return nil, fmt.Errorf("failed to unmarshal raw list sites response: %w", err)
 	}
 
-	// Check for API level error (res != 0)
-	if res, ok := rawResponse["res"].(float64); ok && int(res) != 0 {
-		msg, _ := rawResponse["res_message"].(string)
-		return nil, fmt.Errorf("list sites failed: %s (%d)", msg, int(res))
-	}
-
 	// Look for the sites list in "sites" key (as confirmed by user)
 	// We also check "ApiResultSiteStatus" as fallback just in case or for legacy.
 	var sites []Site
@@ -128,10 +130,51 @@ func (c *Client) ListSites(options map[string]string) ([]Site, error) {
 	return nil, fmt.Errorf("could not find sites list in response: keys checked %v", keysToCheck)
 }
 
+// sitesPageSize is the page size used by ListAllSites.
+const sitesPageSize = 100
+
+// ListAllSites lists every site of the account, walking the pages of ListSites.
+func (c *Client) ListAllSites() ([]Site, error) {
+	return c.ListAllSitesContext(context.Background())
+}
+
+// ListAllSitesContext is like ListAllSites but carries ctx for cancellation and deadlines.
+func (c *Client) ListAllSitesContext(ctx context.Context) ([]Site, error) {
+	var all []Site
+	seen := map[int]bool{}
+	for pageNum := 0; ; pageNum++ {
+		sites, err := c.ListSitesContext(ctx, map[string]string{
+			"page_size": strconv.Itoa(sitesPageSize),
+			"page_num":  strconv.Itoa(pageNum),
+		})
+		if err != nil {
+			return nil, err
+		}
+		added := 0
+		for _, s := range sites {
+			if !seen[s.SiteID] {
+				seen[s.SiteID] = true
+				all = append(all, s)
+				added++
+			}
+		}
+		// A short page is the last one; a page of known sites means the
+		// API ignored page_num.
+		if len(sites) < sitesPageSize || added == 0 {
+			return all, nil
+		}
+	}
+}
+
 // GetSiteStatus retrieves the status of a specific site.
 // tests can be a comma-separated list of tests to run before retrieving status :
 // "domain_validation", "services", "dns".
 func (c *Client) GetSiteStatus(siteID int, tests string) (*Site, error) {
+	return c.GetSiteStatusContext(context.Background(), siteID, tests)
+}
+
+// GetSiteStatusContext is like GetSiteStatus but carries ctx for cancellation and deadlines.
+func (c *Client) GetSiteStatusContext(ctx context.Context, siteID int, tests string) (*Site, error) {
 	u := url.Values{}
 	u.Set("site_id", fmt.Sprintf("%d", siteID))
 	if tests != "" {
@@ -140,8 +183,8 @@ func (c *Client) GetSiteStatus(siteID int, tests string) (*Site, error) {
 
 	path := "/api/prov/v1/sites/status?" + u.Encode()
 
-	// API is POST.
-	respBody, err := c.Post(path, map[string]string{})
+	// API is POST, but read-only so it can be retried.
+	respBody, err := c.PostContext(WithRetry(ctx), path, map[string]string{})
 	if err != nil {
 		return nil, err
 	}
@@ -161,9 +204,5 @@ func (c *Client) GetSiteStatus(siteID int, tests string) (*Site, error) {
 		return nil, fmt.Errorf("failed to unmarshal site status response: %w", err)
 	}
 
-	if wrapper.Res != 0 {
-		return nil, fmt.Errorf("get site status failed: %s (%d)", wrapper.ResMessage, wrapper.Res)
-	}
-
 	return &wrapper.Site, nil
 }
@@ -0,0 +1,210 @@
+package imperva
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SnapshotVersion is the version of the snapshot file format written by this package.
+const SnapshotVersion = 1
+
+// Snapshot is a point-in-time copy of the rules of one or more sites.
+type Snapshot struct {
+	Version  int            `json:"version"`
+	TakenAt  time.Time      `json:"taken_at"`
+	Sites    []SiteSnapshot `json:"sites"`
+	Checksum string         `json:"checksum"` // hex SHA-256 of the JSON encoding of Sites
+}
+
+// SiteSnapshot holds the rules of a site at snapshot time.
+type SiteSnapshot struct {
+	SiteID int    `json:"site_id"`
+	Rules  []Rule `json:"rules"`
+}
+
+// Site returns the snapshot of siteID, if the snapshot covers it.
+func (s *Snapshot) Site(siteID int) (*SiteSnapshot, bool) {
+	for i := range s.Sites {
+		if s.Sites[i].SiteID == siteID {
+			return &s.Sites[i], true
+		}
+	}
+	return nil, false
+}
+
+func (s *Snapshot) computeChecksum() (string, error) {
+	b, err := json.Marshal(s.Sites)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Verify checks the version and checksum of the snapshot.
+func (s *Snapshot) Verify() error {
+	if s.Version != SnapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d, expected %d", s.Version, SnapshotVersion)
+	}
+	sum, err := s.computeChecksum()
+	if err != nil {
+		return err
+	}
+	if sum != s.Checksum {
+		return fmt.Errorf("snapshot checksum mismatch: file says %s, content is %s", s.Checksum, sum)
+	}
+	return nil
+}
+
+// SnapshotOptions controls TakeSnapshot.
+type SnapshotOptions struct {
+	// Detailed fetches every rule individually with GetRule instead of
+	// relying on the listing alone.
+	Detailed bool
+}
+
+// TakeSnapshot captures the rules of the given sites.
+func (c *Client) TakeSnapshot(siteIDs []int, opts SnapshotOptions) (*Snapshot, error) {
+	return c.TakeSnapshotContext(context.Background(), siteIDs, opts)
+}
+
+// TakeSnapshotContext is like TakeSnapshot but carries ctx for cancellation and deadlines.
+func (c *Client) TakeSnapshotContext(ctx context.Context, siteIDs []int, opts SnapshotOptions) (*Snapshot, error) {
+	snap := &Snapshot{Version: SnapshotVersion, TakenAt: time.Now().UTC()}
+	for _, siteID := range siteIDs {
+		rules, err := c.ListRulesContext(ctx, siteID)
+		if err != nil {
+			return nil, fmt.Errorf("site %d: %w", siteID, err)
+		}
+		if opts.Detailed {
+			for i, r := range rules {
+				full, err := c.GetRuleContext(ctx, siteID, r.ID)
+				if err != nil {
+					return nil, fmt.Errorf("site %d: rule %d: %w", siteID, r.ID, err)
+				}
+				rules[i] = *full
+			}
+		}
+		if rules == nil {
+			rules = []Rule{}
+		}
+		snap.Sites = append(snap.Sites, SiteSnapshot{SiteID: siteID, Rules: rules})
+	}
+
+	sum, err := snap.computeChecksum()
+	if err != nil {
+		return nil, err
+	}
+	snap.Checksum = sum
+	return snap, nil
+}
+
+// SaveSnapshot writes snap to dir in a file named after its timestamp,
+// e.g. rules-20060102T150405Z.json, and returns the file path.
+func SaveSnapshot(dir string, snap *Snapshot) (string, error) {
+	b, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, "rules-"+snap.TakenAt.UTC().Format("20060102T150405Z")+".json")
+	if err := os.WriteFile(path, append(b, '\n'), 0o644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// LoadSnapshot reads the snapshot file at path and verifies its checksum.
+func LoadSnapshot(path string) (*Snapshot, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var snap Snapshot
+	if err := json.Unmarshal(b, &snap); err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot %s: %w", path, err)
+	}
+	if err := snap.Verify(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &snap, nil
+}
+
+// DiffSnapshots returns, for every site of to, the changes turning the
+// rules of from into those of to. Sites missing from from are compared
+// against an empty rule set.
+func DiffSnapshots(from, to *Snapshot) ([]*Plan, error) {
+	var plans []*Plan
+	for _, site := range to.Sites {
+		var before []Rule
+		if s, ok := from.Site(site.SiteID); ok {
+			before = s.Rules
+		}
+		plan, err := ComputePlan(site.SiteID, before, site.Rules, PlanOptions{Prune: true, MatchByID: true})
+		if err != nil {
+			return nil, fmt.Errorf("site %d: %w", site.SiteID, err)
+		}
+		plans = append(plans, plan)
+	}
+	return plans, nil
+}
+
+// RestoreOptions controls RestoreSnapshot.
+type RestoreOptions struct {
+	// SiteIDs restricts the restore to these sites; all sites of the snapshot when empty.
+	SiteIDs []int
+	// Prune deletes rules created after the snapshot.
+	Prune bool
+	// DryRun computes the plans without applying them.
+	DryRun bool
+	Apply  ApplyOptions
+}
+
+// RestoreSnapshot brings the rules of the snapshot sites back to their
+// snapshot state, recreating deleted rules and updating modified ones.
+// Rules are matched by ID, so renamed rules get their name back and
+// duplicate names are restored as they were.
+func (c *Client) RestoreSnapshot(snap *Snapshot, opts RestoreOptions) ([]SiteImport, error) {
+	return c.RestoreSnapshotContext(context.Background(), snap, opts)
+}
+
+// RestoreSnapshotContext is like RestoreSnapshot but carries ctx for cancellation and deadlines.
+func (c *Client) RestoreSnapshotContext(ctx context.Context, snap *Snapshot, opts RestoreOptions) ([]SiteImport, error) {
+	if err := snap.Verify(); err != nil {
+		return nil, err
+	}
+
+	siteIDs := opts.SiteIDs
+	if len(siteIDs) == 0 {
+		for _, s := range snap.Sites {
+			siteIDs = append(siteIDs, s.SiteID)
+		}
+	}
+
+	var out []SiteImport
+	for _, siteID := range siteIDs {
+		site, ok := snap.Site(siteID)
+		if !ok {
+			return out, fmt.Errorf("site %d is not part of the snapshot", siteID)
+		}
+
+		plan, err := c.PlanRulesContext(ctx, siteID, site.Rules, PlanOptions{Prune: opts.Prune, MatchByID: true})
+		if err != nil {
+			return out, fmt.Errorf("site %d: %w", siteID, err)
+		}
+		imp := SiteImport{Plan: plan}
+		if !opts.DryRun {
+			imp.Results, err = c.ApplyPlanContext(ctx, plan, opts.Apply)
+		}
+		out = append(out, imp)
+		if err != nil {
+			return out, fmt.Errorf("site %d: %w", siteID, err)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,72 @@
+package imperva_test
+
+import (
+	"testing"
+
+	"imperva-waf-client"
+	"imperva-waf-client/impervatest"
+)
+
+func TestRestoreSnapshotMatchesByID(t *testing.T) {
+	srv := impervatest.NewServer()
+	defer srv.Close()
+	srv.AddSite(imperva.Site{SiteID: 1, Domain: "example.com"})
+	a := srv.AddRule(1, imperva.Rule{Name: "dup", Action: imperva.RuleActionBlock, Filter: `URL == "/a"`})
+	b := srv.AddRule(1, imperva.Rule{Name: "dup", Action: imperva.RuleActionBlock, Filter: `URL == "/b"`})
+	c := srv.AddRule(1, imperva.Rule{Name: "renamed later", Action: imperva.RuleActionAlert, Filter: `URL == "/c"`})
+	client := srv.Client()
+
+	snap, err := client.TakeSnapshot([]int{1}, imperva.SnapshotOptions{})
+	if err != nil {
+		t.Fatalf("TakeSnapshot: %v", err)
+	}
+
+	// Damage the site: rename a rule, change a duplicate, delete the other one.
+	if _, err := client.PatchRule(1, c.ID, imperva.RulePatch{Name: ptr("new name")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.PatchRule(1, b.ID, imperva.RulePatch{Filter: ptr(`URL == "/changed"`)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.DeleteRule(1, a.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := client.TakeSnapshot([]int{1}, imperva.SnapshotOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plans, err := imperva.DiffSnapshots(after, snap)
+	if err != nil {
+		t.Fatalf("DiffSnapshots: %v", err)
+	}
+	if got := len(plans[0].Changes); got != 3 {
+		t.Errorf("DiffSnapshots = %s, want 3 changes", plans[0])
+	}
+
+	imports, err := client.RestoreSnapshot(snap, imperva.RestoreOptions{Prune: true})
+	if err != nil {
+		t.Fatalf("RestoreSnapshot: %v", err)
+	}
+	for _, ch := range imports[0].Plan.Changes {
+		if ch.Action == imperva.ChangeDelete {
+			t.Errorf("restore deleted rule %q (id %d), want it updated", ch.Name, ch.Current.ID)
+		}
+	}
+
+	rules := srv.Rules(1)
+	if len(rules) != 3 {
+		t.Fatalf("rules after restore = %+v, want 3", rules)
+	}
+	if rules[0].ID != b.ID || rules[0].Filter != `URL == "/b"` {
+		t.Errorf("rule %d = %+v, want its filter restored", b.ID, rules[0])
+	}
+	if rules[1].ID != c.ID || rules[1].Name != "renamed later" {
+		t.Errorf("rule %d = %+v, want its name restored", c.ID, rules[1])
+	}
+	if rules[2].Name != "dup" || rules[2].Filter != `URL == "/a"` {
+		t.Errorf("recreated rule = %+v, want the deleted duplicate back", rules[2])
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
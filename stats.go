@@ -1,6 +1,7 @@
 package imperva
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/url"
@@ -9,16 +10,26 @@ import (
 
 // Visit represents a log entry/visit.
 type Visit struct {
-	ID          string   `json:"id"`
-	SiteID      int      `json:"siteId"`
-	ClientIPs   []string `json:"clientIPs"`
-	Countries   []string `json:"country"`
-	CountryCode []string `json:"countryCode"`
-	StartTime   int64    `json:"startTime"` // Unix timestamp
-	EndTime     int64    `json:"endTime"`   // Unix timestamp
+	ID           string        `json:"id"`
+	SiteID       int           `json:"siteId"`
+	ClientIPs    []string      `json:"clientIPs"`
+	Countries    []string      `json:"country"`
+	CountryCode  []string      `json:"countryCode"`
+	StartTime    int64         `json:"startTime"` // Unix timestamp
+	EndTime      int64         `json:"endTime"`   // Unix timestamp
+	UserAgent    string        `json:"userAgent,omitempty"`
+	EntryReferer string        `json:"entryReferer,omitempty"`
+	Actions      []VisitAction `json:"actions,omitempty"`
 	// Add other fields as discovered/needed
 }
 
+// VisitAction is a request made during a visit.
+type VisitAction struct {
+	URL           string `json:"url"` // host and path, e.g. "example.com/login?next=/"
+	HTTPMethod    string `json:"httpMethod,omitempty"`
+	RequestResult string `json:"requestResult,omitempty"`
+}
+
 // VisitOptions options for querying visits
 type VisitOptions struct {
 	TimeRange      string // e.g. 'last_7_days' (default), 'today', 'last_30_days', 'custom'
@@ -55,6 +66,11 @@ func (p *TimeseriesPoint) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// MarshalJSON encodes the point back to its [timestamp, value] array form.
+func (p TimeseriesPoint) MarshalJSON() ([]byte, error) {
+	return json.Marshal([2]float64{float64(p.Timestamp), p.Value})
+}
+
 // StatsData represents a single statistics series.
 type StatsData struct {
 	ID   string            `json:"id"`
@@ -81,6 +97,11 @@ type StatsResponse struct {
 
 // GetVisits retrieves traffic logs (visits).
 func (c *Client) GetVisits(siteID int, opts VisitOptions) ([]Visit, error) {
+	return c.GetVisitsContext(context.Background(), siteID, opts)
+}
+
+// GetVisitsContext is like GetVisits but carries ctx for cancellation and deadlines.
+func (c *Client) GetVisitsContext(ctx context.Context, siteID int, opts VisitOptions) ([]Visit, error) {
 	u := url.Values{}
 	u.Set("site_id", strconv.Itoa(siteID))
 
@@ -101,7 +122,8 @@ func (c *Client) GetVisits(siteID int, opts VisitOptions) ([]Visit, error) {
 	// This makes sense for Imperva (POST with query params).
 
 	path := "/api/visits/v1?" + u.Encode()
-	respBody, err := c.Post(path, nil)
+	// Both visits and stats endpoints are read-only, so the POST can be retried.
+	respBody, err := c.PostContext(WithRetry(ctx), path, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -142,6 +164,11 @@ func (c *Client) GetVisits(siteID int, opts VisitOptions) ([]Visit, error) {
 // * `delivery_rules` List of delivery rules with total number of hits for each rule.
 // * `delivery_rules_timeseries` List of delivery rules with a series of hits for each rule with the specified granularity.
 func (c *Client) GetStats(siteID int, opts StatsOptions) (*StatsResponse, error) {
+	return c.GetStatsContext(context.Background(), siteID, opts)
+}
+
+// GetStatsContext is like GetStats but carries ctx for cancellation and deadlines.
+func (c *Client) GetStatsContext(ctx context.Context, siteID int, opts StatsOptions) (*StatsResponse, error) {
 	u := url.Values{}
 	u.Set("site_id", strconv.Itoa(siteID))
 	if opts.TimeRange != "" {
@@ -152,7 +179,7 @@ func (c *Client) GetStats(siteID int, opts StatsOptions) (*StatsResponse, error)
 	}
 
 	path := "/api/stats/v1?" + u.Encode()
-	respBody, err := c.Post(path, nil)
+	respBody, err := c.PostContext(WithRetry(ctx), path, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,263 @@
+package imperva
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"imperva-waf-client/filter"
+)
+
+// TemplateVars maps placeholder names, as in {{domain}}, to their values.
+type TemplateVars map[string]string
+
+// placeholderRe matches a {{name}} placeholder.
+var placeholderRe = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.-]+)\s*\}\}`)
+
+// SiteVars returns the placeholders derived from a site: site_id, domain,
+// display_name and account_id.
+func SiteVars(site Site) TemplateVars {
+	return TemplateVars{
+		"site_id":      strconv.Itoa(site.SiteID),
+		"domain":       site.Domain,
+		"display_name": site.DisplayName,
+		"account_id":   strconv.Itoa(site.AccountId),
+	}
+}
+
+// render replaces the placeholders of s with vars, failing on unknown ones.
+func render(s string, vars TemplateVars) (string, error) {
+	var missing []string
+	out := placeholderRe.ReplaceAllStringFunc(s, func(m string) string {
+		name := placeholderRe.FindStringSubmatch(m)[1]
+		v, ok := vars[name]
+		if !ok {
+			missing = append(missing, name)
+		}
+		return v
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("undefined placeholder %q", missing[0])
+	}
+	return out, nil
+}
+
+// renderFilter is like render for a filter: values placed inside a quoted
+// filter value are escaped, other values are inserted verbatim.
+func renderFilter(src string, vars TemplateVars) (string, error) {
+	var b strings.Builder
+	quoted, last := false, 0
+	for _, m := range placeholderRe.FindAllStringSubmatchIndex(src, -1) {
+		quoted = inQuotes(src[last:m[0]], quoted)
+		b.WriteString(src[last:m[0]])
+		name := src[m[2]:m[3]]
+		v, ok := vars[name]
+		if !ok {
+			return "", fmt.Errorf("undefined placeholder %q", name)
+		}
+		if quoted {
+			q := filter.Quote(v)
+			v = q[1 : len(q)-1]
+		}
+		b.WriteString(v)
+		last = m[1]
+	}
+	b.WriteString(src[last:])
+	return b.String(), nil
+}
+
+// inQuotes reports whether a quoted filter value is open after s, given
+// whether one was open before it.
+func inQuotes(s string, quoted bool) bool {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if quoted {
+				i++
+			}
+		case '"':
+			quoted = !quoted
+		}
+	}
+	return quoted
+}
+
+// RenderRule returns tmpl with the placeholders of its string fields
+// replaced by vars. Values placed inside a quoted filter value are escaped;
+// elsewhere they are inserted verbatim, and a filter holding placeholders
+// must parse once rendered.
+func RenderRule(tmpl Rule, vars TemplateVars) (Rule, error) {
+	rule := tmpl
+	f, err := renderFilter(tmpl.Filter, vars)
+	if err != nil {
+		return Rule{}, fmt.Errorf("render rule %q: %w", tmpl.Name, err)
+	}
+	if f != tmpl.Filter {
+		if _, err := filter.Parse(f); err != nil {
+			return Rule{}, fmt.Errorf("render rule %q: filter %q: %w", tmpl.Name, f, err)
+		}
+	}
+	rule.Filter = f
+	fields := []*string{
+		&rule.Name,
+		&rule.From,
+		&rule.To,
+		&rule.RewriteName,
+		&rule.PortForwardingValue,
+		&rule.ErrorResponseData,
+	}
+	for _, f := range fields {
+		s, err := render(*f, vars)
+		if err != nil {
+			return Rule{}, fmt.Errorf("render rule %q: %w", tmpl.Name, err)
+		}
+		*f = s
+	}
+	return rule, nil
+}
+
+// isTemplate reports whether any string field of r holds a placeholder.
+func isTemplate(r Rule) bool {
+	for _, s := range []string{r.Name, r.Filter, r.From, r.To, r.RewriteName, r.PortForwardingValue, r.ErrorResponseData} {
+		if placeholderRe.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// ExistingRules tells ApplyTemplates and CopyRules what to do with a target
+// rule having the same name as a rule being stamped.
+type ExistingRules int
+
+const (
+	SkipExisting   ExistingRules = iota // leave the existing rule as it is
+	UpdateExisting                      // update it to match
+)
+
+// TemplateOptions controls ApplyTemplates and CopyRules.
+type TemplateOptions struct {
+	// Vars are placeholders shared by every site. They override the site
+	// attributes of SiteVars.
+	Vars TemplateVars
+	// SiteVars are per-site placeholders, e.g. admin_path, overriding Vars.
+	SiteVars map[int]TemplateVars
+	Existing ExistingRules
+	Apply    ApplyOptions
+	// DryRun computes the plans without applying them.
+	DryRun bool
+}
+
+// SiteCopy is the outcome of stamping rules onto one site.
+type SiteCopy struct {
+	Plan    *Plan
+	Skipped []string // names of existing rules left untouched by SkipExisting
+	Results []ApplyResult
+}
+
+// SelectRulesByName returns a CopyRules selector matching the given rule names.
+func SelectRulesByName(names ...string) func(Rule) bool {
+	return func(r Rule) bool { return slices.Contains(names, r.Name) }
+}
+
+// ApplyTemplates renders templates for every site of siteIDs, using the site
+// attributes from ListAllSites and the variables of opts, and creates the
+// resulting rules, matching existing rules by rendered name.
+func (c *Client) ApplyTemplates(templates []Rule, siteIDs []int, opts TemplateOptions) ([]SiteCopy, error) {
+	return c.ApplyTemplatesContext(context.Background(), templates, siteIDs, opts)
+}
+
+// ApplyTemplatesContext is like ApplyTemplates but carries ctx for cancellation and deadlines.
+func (c *Client) ApplyTemplatesContext(ctx context.Context, templates []Rule, siteIDs []int, opts TemplateOptions) ([]SiteCopy, error) {
+	return c.stampRules(ctx, templates, siteIDs, opts)
+}
+
+// CopyRules clones the rules of fromSite accepted by selector, or all of
+// them when selector is nil, onto every site of toSites. Rules holding
+// placeholders are rendered per site as by ApplyTemplates.
+func (c *Client) CopyRules(fromSite int, toSites []int, selector func(Rule) bool, opts TemplateOptions) ([]SiteCopy, error) {
+	return c.CopyRulesContext(context.Background(), fromSite, toSites, selector, opts)
+}
+
+// CopyRulesContext is like CopyRules but carries ctx for cancellation and deadlines.
+func (c *Client) CopyRulesContext(ctx context.Context, fromSite int, toSites []int, selector func(Rule) bool, opts TemplateOptions) ([]SiteCopy, error) {
+	var rules []Rule
+	for rule, err := range c.IterRules(ctx, fromSite) {
+		if err != nil {
+			return nil, fmt.Errorf("site %d: %w", fromSite, err)
+		}
+		if selector == nil || selector(rule) {
+			rules = append(rules, rule)
+		}
+	}
+	toSites = slices.DeleteFunc(slices.Clone(toSites), func(id int) bool { return id == fromSite })
+	return c.stampRules(ctx, rules, toSites, opts)
+}
+
+// stampRules renders rules for each site and reconciles the site with them,
+// without pruning its other rules.
+func (c *Client) stampRules(ctx context.Context, rules []Rule, siteIDs []int, opts TemplateOptions) ([]SiteCopy, error) {
+	var sites map[int]Site
+	if slices.ContainsFunc(rules, isTemplate) {
+		list, err := c.ListAllSitesContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		sites = make(map[int]Site, len(list))
+		for _, s := range list {
+			sites[s.SiteID] = s
+		}
+	}
+
+	var out []SiteCopy
+	for _, siteID := range siteIDs {
+		desired := rules
+		if sites != nil {
+			site, ok := sites[siteID]
+			if !ok {
+				return out, fmt.Errorf("site %d: not found in the account sites", siteID)
+			}
+			vars := SiteVars(site)
+			for k, v := range opts.Vars {
+				vars[k] = v
+			}
+			for k, v := range opts.SiteVars[siteID] {
+				vars[k] = v
+			}
+			desired = make([]Rule, len(rules))
+			for i, tmpl := range rules {
+				r, err := RenderRule(tmpl, vars)
+				if err != nil {
+					return out, fmt.Errorf("site %d: %w", siteID, err)
+				}
+				desired[i] = r
+			}
+		}
+
+		plan, err := c.PlanRulesContext(ctx, siteID, desired, PlanOptions{})
+		if err != nil {
+			return out, fmt.Errorf("site %d: %w", siteID, err)
+		}
+		sc := SiteCopy{Plan: plan}
+		if opts.Existing == SkipExisting {
+			plan.Changes = slices.DeleteFunc(plan.Changes, func(ch RuleChange) bool {
+				if ch.Action == ChangeUpdate {
+					sc.Skipped = append(sc.Skipped, ch.Name)
+					return true
+				}
+				return false
+			})
+		}
+		if !opts.DryRun {
+			sc.Results, err = c.ApplyPlanContext(ctx, plan, opts.Apply)
+		}
+		out = append(out, sc)
+		if err != nil {
+			return out, fmt.Errorf("site %d: %w", siteID, err)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,52 @@
+package imperva_test
+
+import (
+	"fmt"
+	"testing"
+
+	"imperva-waf-client"
+	"imperva-waf-client/filter"
+	"imperva-waf-client/impervatest"
+)
+
+func TestApplyTemplatesBeyondFirstSitesPage(t *testing.T) {
+	srv := impervatest.NewServer()
+	defer srv.Close()
+	for id := 1; id <= 130; id++ {
+		srv.AddSite(imperva.Site{SiteID: id, Domain: fmt.Sprintf("site%d.example.com", id)})
+	}
+	client := srv.Client()
+
+	tmpl := imperva.Rule{Name: "block {{domain}} admin", Action: imperva.RuleActionBlock, Filter: `URL == "/{{domain}}/admin"`}
+	if _, err := client.ApplyTemplates([]imperva.Rule{tmpl}, []int{130}, imperva.TemplateOptions{}); err != nil {
+		t.Fatalf("ApplyTemplates: %v", err)
+	}
+	rules := srv.Rules(130)
+	if len(rules) != 1 || rules[0].Filter != `URL == "/site130.example.com/admin"` {
+		t.Errorf("site 130 rules = %+v, want the rendered template", rules)
+	}
+}
+
+func TestRenderRuleEscapesQuotedValues(t *testing.T) {
+	path := `/a"b & c | d\`
+	tmpl := imperva.Rule{Name: "block", Action: imperva.RuleActionBlock, Filter: `URL == "{{path}}" & Method == GET`}
+
+	rule, err := imperva.RenderRule(tmpl, imperva.TemplateVars{"path": path})
+	if err != nil {
+		t.Fatalf("RenderRule: %v", err)
+	}
+	n, err := filter.Parse(rule.Filter)
+	if err != nil {
+		t.Fatalf("rendered filter %q does not parse: %v", rule.Filter, err)
+	}
+	conds := filter.Conditions(n)
+	if len(conds) != 2 || conds[0].Values[0].Text != path {
+		t.Errorf("rendered filter %q, want the URL condition to hold %q", rule.Filter, path)
+	}
+
+	// Outside quotes values are inserted verbatim and must leave a valid filter.
+	tmpl.Filter = `URL == {{path}}`
+	if _, err := imperva.RenderRule(tmpl, imperva.TemplateVars{"path": path}); err == nil {
+		t.Error("RenderRule with an unparsable rendered filter succeeded")
+	}
+}
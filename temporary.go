@@ -0,0 +1,116 @@
+package imperva
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// Temporary rules carry their expiry in their name, as a suffix of the form
+// " [expires:2006-01-02T15:04:05Z]", so they can be found and removed by
+// ExpireRules without any local state.
+const expiryTagFormat = " [expires:%s]"
+
+var expiryTagRe = regexp.MustCompile(` \[expires:([^\]]+)\]$`)
+
+// TemporaryRuleName returns name tagged with an expiry at t.
+func TemporaryRuleName(name string, t time.Time) string {
+	return expiryTagRe.ReplaceAllString(name, "") + fmt.Sprintf(expiryTagFormat, t.UTC().Format(time.RFC3339))
+}
+
+// RuleExpiry returns the expiry of a temporary rule, and false for permanent rules.
+func RuleExpiry(rule Rule) (time.Time, bool) {
+	m := expiryTagRe.FindStringSubmatch(rule.Name)
+	if m == nil {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339, m[1])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// CreateTemporaryRule creates a rule that ExpireRules deletes once ttl has elapsed.
+func (c *Client) CreateTemporaryRule(siteID int, rule Rule, ttl time.Duration) (*Rule, error) {
+	return c.CreateTemporaryRuleContext(context.Background(), siteID, rule, ttl)
+}
+
+// CreateTemporaryRuleContext is like CreateTemporaryRule but carries ctx for cancellation and deadlines.
+func (c *Client) CreateTemporaryRuleContext(ctx context.Context, siteID int, rule Rule, ttl time.Duration) (*Rule, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("temporary rule %q: ttl must be positive, got %s", rule.Name, ttl)
+	}
+	rule.Name = TemporaryRuleName(rule.Name, time.Now().Add(ttl))
+	return c.CreateRuleContext(ctx, siteID, rule)
+}
+
+// ExpireOptions controls ExpireRules.
+type ExpireOptions struct {
+	// DryRun reports the expired rules without deleting them.
+	DryRun bool
+	// Now is the reference time, time.Now when zero.
+	Now time.Time
+}
+
+// ExpiredRule is a temporary rule found expired by ExpireRules.
+type ExpiredRule struct {
+	SiteID    int
+	Rule      Rule
+	ExpiredAt time.Time
+	Deleted   bool
+	Err       error // deletion failure, or a *JournalError when deleted but not journaled
+}
+
+// ExpireReport is the outcome of ExpireRules.
+type ExpireReport struct {
+	Checked int // temporary rules inspected
+	Expired []ExpiredRule
+}
+
+// Failed returns the expired rules that could not be deleted.
+func (r *ExpireReport) Failed() []ExpiredRule {
+	var out []ExpiredRule
+	for _, e := range r.Expired {
+		if e.Err != nil && !e.Deleted {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// ExpireRules finds the expired temporary rules of the given sites and
+// deletes them, unless opts.DryRun is set. Deletion failures are recorded in
+// the report and do not stop the run.
+func (c *Client) ExpireRules(siteIDs []int, opts ExpireOptions) (*ExpireReport, error) {
+	return c.ExpireRulesContext(context.Background(), siteIDs, opts)
+}
+
+// ExpireRulesContext is like ExpireRules but carries ctx for cancellation and deadlines.
+func (c *Client) ExpireRulesContext(ctx context.Context, siteIDs []int, opts ExpireOptions) (*ExpireReport, error) {
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	rules, err := c.ListRulesForSitesContext(ctx, siteIDs, RuleQuery{NameContains: " [expires:"})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ExpireReport{Checked: len(rules)}
+	for _, r := range rules {
+		at, ok := RuleExpiry(r.Rule)
+		if !ok || at.After(now) {
+			continue
+		}
+		exp := ExpiredRule{SiteID: r.SiteID, Rule: r.Rule, ExpiredAt: at}
+		if !opts.DryRun {
+			exp.Err = c.DeleteRuleContext(ctx, r.SiteID, r.ID)
+			exp.Deleted = exp.Err == nil || isJournalError(exp.Err)
+		}
+		report.Expired = append(report.Expired, exp)
+	}
+	return report, nil
+}